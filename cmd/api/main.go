@@ -6,14 +6,21 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"pornterest/internal/config"
 	"pornterest/internal/database"
 	"pornterest/internal/elasticsearch"
+	"pornterest/internal/engagement"
+	"pornterest/internal/feed"
 	"pornterest/internal/handlers"
+	"pornterest/internal/hashindex"
+	"pornterest/internal/outbox"
 	"pornterest/internal/routes"
+	"pornterest/internal/storage"
+	"pornterest/internal/tagsuggest"
 	"pornterest/internal/tasks" // добавляем импорт
-	"pornterest/internal/tools"
+	"pornterest/internal/uploads"
 
 	"log/slog" // добавляем для логгера
 
@@ -49,6 +56,13 @@ func main() {
 	}
 	defer sqlDB.Close()
 
+	// Отказываемся работать со схемой, к которой не применены миграции этой версии кода
+	if cfg.SchemaCheck {
+		if err := database.CheckSchema(dbGORM); err != nil {
+			log.Fatalf("Schema check failed: %v", err)
+		}
+	}
+
 	// Инициализация TaskQueue
 	taskQueue := tasks.NewTaskQueue(dbGORM, logger)
 	taskQueue.StartProcessing()
@@ -59,17 +73,58 @@ func main() {
 		log.Fatalf("Failed to create Elasticsearch client: %v", err)
 	}
 
-	// Create index if it doesn't exist
-	if err := esClient.CreateIndex(context.Background(), "pins"); err != nil {
+	// Создаем версию индекса за алиасом pins, если ее еще нет
+	if err := esClient.EnsurePinIndex(context.Background()); err != nil {
 		log.Fatalf("Failed to create Elasticsearch index: %v", err)
 	}
 
+	// Индекс подсказок тегов догоняет таблицу tags по updated_at
+	if err := esClient.EnsureTagIndex(context.Background()); err != nil {
+		log.Fatalf("Failed to create Elasticsearch tag index: %v", err)
+	}
+	tagsuggest.NewSyncer(dbGORM, esClient, logger).Start(5 * time.Second)
+
+	// Изменения пинов попадают в индекс через outbox, который пишется в одной транзакции с ними
+	outbox.NewWorker(dbGORM, esClient, logger).Start(2 * time.Second)
+
+	// Лайки, сохранения и комментарии для сортировки поиска переносятся в индекс пачками
+	engagement.NewSyncer(dbGORM, esClient, logger).Start(time.Minute)
+
+	// Хранилище медиафайлов
+	mediaStorage, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+
+	// Индекс перцептивных хэшей для поиска дубликатов и обратного поиска по изображению
+	hashIndex := hashindex.New()
+	if loaded, err := hashIndex.Load(dbGORM); err != nil {
+		log.Fatalf("Failed to load image hash index: %v", err)
+	} else {
+		logger.Info("loaded image hash index", "pins", loaded)
+	}
+	hashIndex.StartSync(dbGORM, 30*time.Second, logger)
+
+	// Состояние возобновляемых загрузок переживает перезапуск: данные на диске, смещения в базе
+	uploadStore, err := uploads.NewStore(dbGORM, cfg.UploadTempDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize upload store: %v", err)
+	}
+	uploadStore.StartCleanup(time.Hour, logger)
+
+	// Домашние ленты собираются при чтении и кэшируются в памяти
+	feedService := feed.NewService(dbGORM)
+
 	// Создание обработчиков
-	pinHandler := handlers.NewPinHandler(dbGORM, taskQueue, esClient)
-	userHandler := handlers.NewUserHandler(dbGORM, cfg)
+	pinHandler := handlers.NewPinHandler(dbGORM, taskQueue, esClient, mediaStorage, hashIndex)
+	userHandler := handlers.NewUserHandler(dbGORM, cfg, mediaStorage)
 	actionHandler := handlers.NewActionHandler(dbGORM)
-	subscriptionHandler := handlers.NewSubscriptionHandler(dbGORM)
-	tagHandler := handlers.NewTagHandler(dbGORM)
+	subscriptionHandler := handlers.NewSubscriptionHandler(dbGORM, feedService)
+	blockHandler := handlers.NewBlockHandler(dbGORM, feedService)
+	tagHandler := handlers.NewTagHandler(dbGORM, esClient, feedService)
+	boardHandler := handlers.NewBoardHandler(dbGORM, mediaStorage)
+	uploadHandler := handlers.NewResumableUploadHandler(uploadStore, pinHandler)
+	feedHandler := handlers.NewFeedHandler(dbGORM, mediaStorage, feedService)
 
 	// Создаем роутер gorilla/mux
 	router := mux.NewRouter()
@@ -77,25 +132,25 @@ func main() {
 	// Настройка CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS", "PUT"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS", "PUT", "PATCH", "HEAD"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Defer-Length"},
+		ExposedHeaders: []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "Pin-Id"},
 	})
 
 	// Регистрация маршрутов
 	routes.SetupPinRoutes(router, pinHandler, actionHandler, cfg)
-	routes.SetupUserRoutes(router, userHandler, subscriptionHandler, cfg)
+	routes.SetupUserRoutes(router, userHandler, subscriptionHandler, blockHandler, cfg)
 	routes.SetupTagRoutes(router, tagHandler, cfg)
+	routes.SetupBoardRoutes(router, boardHandler, cfg)
+	routes.SetupUploadRoutes(router, uploadHandler, cfg)
+	routes.SetupFeedRoutes(router, feedHandler, cfg)
 
 	// Маршрут для статики
-	router.PathPrefix("/upload/").Handler(http.StripPrefix("/upload/", http.FileServer(http.Dir("./upload"))))
+	router.PathPrefix("/upload/").Handler(http.StripPrefix("/upload/", storage.Handler(mediaStorage)))
 
 	// Применяем CORS middleware
 	handler := c.Handler(router)
 
-	if err := tools.ReindexAllPins(dbGORM, esClient); err != nil {
-		log.Printf("Failed to reindex pins: %v", err)
-	}
-
 	// Запуск сервера
 	fmt.Printf("Server listening on port %s\n", cfg.Port)
 	err = http.ListenAndServe(fmt.Sprintf(":%s", cfg.Port), handler)
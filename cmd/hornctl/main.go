@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"pornterest/internal/config"
+	"pornterest/internal/database"
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/storage"
+	"pornterest/internal/tools"
+
+	"gorm.io/gorm"
+)
+
+// command — подкоманда hornctl. setup регистрирует ее флаги и возвращает функцию запуска
+type command struct {
+	usage string
+	setup func(fs *flag.FlagSet) func(env *env) error
+}
+
+var commands = map[string]command{
+	"reindex": {
+		usage: "build a new version of the pins index and switch the alias to it",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			return func(env *env) error {
+				es, err := env.elasticsearch()
+				if err != nil {
+					return err
+				}
+				return tools.RebuildPinIndex(env.db, es, env.dryRun)
+			}
+		},
+	},
+	"reindex-tags": {
+		usage: "recreate the tag suggestion index and fill it with all tags",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			return func(env *env) error {
+				es, err := env.elasticsearch()
+				if err != nil {
+					return err
+				}
+				return tools.RebuildTagIndex(env.db, es, env.dryRun)
+			}
+		},
+	},
+	"recount-tags": {
+		usage: "recalculate tag counters from pin_tags",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			return func(env *env) error {
+				return tools.RecountTags(env.db, env.dryRun)
+			}
+		},
+	},
+	"backfill-renditions": {
+		usage: "generate grid and detail renditions for images that have none",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			return func(env *env) error {
+				store, err := env.storage()
+				if err != nil {
+					return err
+				}
+				return tools.BackfillRenditions(env.db, store, env.dryRun)
+			}
+		},
+	},
+	"translate-tags": {
+		usage: "translate tags without a Russian title",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			limit := fs.Int("limit", 0, "maximum number of tags to translate (0 for all)")
+			return func(env *env) error {
+				return tools.TranslateTags(env.db, *limit, env.dryRun)
+			}
+		},
+	},
+	"create-admin": {
+		usage: "grant admin rights to a user, creating the user if needed",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			email := fs.String("email", "", "email of the user")
+			nickname := fs.String("nickname", "", "nickname for a new user")
+			password := fs.String("password", "", "password for a new user (defaults to $HORNCTL_ADMIN_PASSWORD)")
+			return func(env *env) error {
+				if *password == "" {
+					*password = os.Getenv("HORNCTL_ADMIN_PASSWORD")
+				}
+				return tools.CreateAdmin(env.db, *email, *nickname, *password, env.dryRun)
+			}
+		},
+	},
+	"purge-orphan-media": {
+		usage: "delete media objects that no pin or rendition refers to",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			minAge := fs.Duration("min-age", 24*time.Hour, "skip objects modified more recently than this")
+			return func(env *env) error {
+				store, err := env.storage()
+				if err != nil {
+					return err
+				}
+				return tools.PurgeOrphanMedia(env.db, store, *minAge, env.dryRun)
+			}
+		},
+	},
+	"migrate": {
+		usage: "apply schema migrations, then data migrations (legacy media paths)",
+		setup: func(fs *flag.FlagSet) func(env *env) error {
+			status := fs.Bool("status", false, "list migrations and whether they are applied")
+			down := fs.Int("down", 0, "revert this many latest schema migrations instead of applying")
+			return func(env *env) error {
+				switch {
+				case *status:
+					return printMigrationStatus(env.db)
+				case *down > 0:
+					reverted, err := database.MigrateDown(env.db, *down, env.dryRun)
+					log.Printf("Reverted %d migrations", reverted)
+					return err
+				}
+
+				applied, err := database.MigrateUp(env.db, env.dryRun)
+				log.Printf("Applied %d migrations", applied)
+				if err != nil {
+					return err
+				}
+				return tools.MigratePinPaths(env.db, env.dryRun)
+			}
+		},
+	},
+}
+
+// env — общее окружение подкоманд: конфигурация и подключения, которые создаются по требованию
+type env struct {
+	cfg    config.Config
+	db     *gorm.DB
+	dryRun bool
+}
+
+func (e *env) elasticsearch() (*elasticsearch.ESClient, error) {
+	es, err := elasticsearch.NewESClient([]string{os.Getenv("ELASTICSEARCH_URL")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	return es, nil
+}
+
+func (e *env) storage() (storage.Storage, error) {
+	store, err := storage.New(e.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize media storage: %w", err)
+	}
+	return store, nil
+}
+
+// hornctl — утилита обслуживания: hornctl <command> [--dry-run] [flags]
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "help" && name != "-h" && name != "--help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		}
+		printUsage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "show what would be done without changing anything")
+	run := cmd.setup(fs)
+	fs.Parse(os.Args[2:])
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to get generic database object: %v", err)
+	}
+	defer sqlDB.Close()
+
+	if *dryRun {
+		log.Printf("Dry run: no changes will be made")
+	}
+
+	if err := run(&env{cfg: cfg, db: db, dryRun: *dryRun}); err != nil {
+		sqlDB.Close()
+		log.Fatalf("%s failed: %v", name, err)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: hornctl <command> [--dry-run] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, commands[name].usage)
+	}
+}
+
+func printMigrationStatus(db *gorm.DB) error {
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := database.AppliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		state := "pending"
+		if applied[m.Version] {
+			state = "applied"
+		}
+		fmt.Printf("%04d_%-30s %s\n", m.Version, m.Name, state)
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv" // Убедимся, что импорт присутствует
 )
@@ -11,6 +13,23 @@ type Config struct {
 	Port        string
 	DatabaseURL string
 	JWTSecret   string // Добавляем поле для JWT Secret
+
+	// Хранилище медиафайлов: "local" (по умолчанию) или "s3"
+	StorageDriver   string
+	StorageLocalDir string
+	PublicMediaURL  string // Публичный адрес медиафайлов (сервер API или CDN), к которому дописывается ключ объекта
+	S3Endpoint      string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3Bucket        string
+	S3Region        string
+	S3UseSSL        bool
+
+	// Проверять при старте API, что применены все миграции схемы (SCHEMA_CHECK=false отключает)
+	SchemaCheck bool
+
+	// Каталог для данных незавершенных возобновляемых загрузок; не должен раздаваться публично
+	UploadTempDir string
 }
 
 func LoadConfig() (Config, error) {
@@ -35,9 +54,54 @@ func LoadConfig() (Config, error) {
 		return Config{}, fmt.Errorf("JWT_SECRET environment variable not set")
 	}
 
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	if storageDriver == "" {
+		storageDriver = "local"
+	}
+
+	storageLocalDir := os.Getenv("STORAGE_LOCAL_DIR")
+	if storageLocalDir == "" {
+		storageLocalDir = "upload"
+	}
+
+	publicMediaURL := os.Getenv("PUBLIC_MEDIA_URL")
+	if publicMediaURL == "" {
+		// Объекты S3 сервер API не раздает, поэтому адрес по умолчанию для них заведомо неверен
+		if storageDriver == "s3" {
+			return Config{}, fmt.Errorf("PUBLIC_MEDIA_URL environment variable must be set for s3 storage")
+		}
+		publicMediaURL = "http://localhost:" + port + "/upload/"
+		log.Printf("WARNING: PUBLIC_MEDIA_URL is not set, media URLs will point to %s; set it in production", publicMediaURL)
+	}
+	if !strings.HasSuffix(publicMediaURL, "/") {
+		publicMediaURL += "/"
+	}
+
+	uploadTempDir := os.Getenv("UPLOAD_TEMP_DIR")
+	if uploadTempDir == "" {
+		uploadTempDir = "upload_tmp"
+	}
+
+	if storageDriver == "s3" && (os.Getenv("S3_ENDPOINT") == "" || os.Getenv("S3_BUCKET") == "") {
+		return Config{}, fmt.Errorf("S3_ENDPOINT and S3_BUCKET environment variables must be set for s3 storage")
+	}
+
 	return Config{
 		Port:        port,
 		DatabaseURL: databaseURL,
 		JWTSecret:   jwtSecret, // Загружаем JWT Secret
+
+		StorageDriver:   storageDriver,
+		StorageLocalDir: storageLocalDir,
+		PublicMediaURL:  publicMediaURL,
+		S3Endpoint:      os.Getenv("S3_ENDPOINT"),
+		S3AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		S3Bucket:        os.Getenv("S3_BUCKET"),
+		S3Region:        os.Getenv("S3_REGION"),
+		S3UseSSL:        strings.ToLower(os.Getenv("S3_USE_SSL")) == "true",
+
+		SchemaCheck:   strings.ToLower(os.Getenv("SCHEMA_CHECK")) != "false",
+		UploadTempDir: uploadTempDir,
 	}, nil
 }
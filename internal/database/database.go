@@ -4,23 +4,31 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 // Connect подключается к базе данных PostgreSQL с помощью GORM
 func Connect(databaseURL string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	config, err := pgx.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+	// Миграции сообщают через RAISE NOTICE, сколько строк они удалили или изменили
+	config.OnNotice = func(_ *pgconn.PgConn, n *pgconn.Notice) {
+		log.Printf("Postgres %s: %s", n.Severity, n.Message)
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 	log.Println("Connected to database with GORM")
 
-	// Автоматическая миграция схем (создаст таблицы, если их нет)
-	// err = db.AutoMigrate(&models.Pin{}, &models.User{}, &models.Action{}, &models.UserSubscription{}, &models.Comment{})
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to auto migrate: %w", err)
-	// }
+	// Схема не мигрируется автоматически: миграции применяются явно командой `hornctl migrate`
 
 	return db, nil
 }
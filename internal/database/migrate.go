@@ -0,0 +1,246 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID — ключ advisory-блокировки, чтобы миграции не применялись параллельно из двух процессов
+const migrationLockID = 7_402_115
+
+// Migration — версия схемы: пара файлов NNNN_name.up.sql и NNNN_name.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration — строка таблицы schema_migrations о примененной версии
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrations возвращает встроенные миграции по возрастанию версии
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", file)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// AppliedVersions возвращает примененные версии. Если schema_migrations еще нет, список пуст
+func AppliedVersions(db *gorm.DB) (map[int]bool, error) {
+	applied := make(map[int]bool)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var rows []SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for _, row := range rows {
+		applied[row.Version] = true
+	}
+	return applied, nil
+}
+
+// PendingMigrations возвращает еще не примененные миграции по возрастанию версии
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := AppliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema возвращает ошибку, если в базе применены не все встроенные миграции
+func CheckSchema(db *gorm.DB) error {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date: %d pending migrations starting with %04d_%s, run `hornctl migrate`",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// MigrateUp применяет все непримененные миграции, каждую в своей транзакции.
+// В режиме dryRun только выводит список
+func MigrateUp(db *gorm.DB, dryRun bool) (int, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Found %d pending migrations", len(pending))
+	if dryRun {
+		for _, m := range pending {
+			log.Printf("Would apply %04d_%s", m.Version, m.Name)
+		}
+		return 0, nil
+	}
+
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`).Error; err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := 0
+	for i, m := range pending {
+		log.Printf("[%d/%d] Applying %04d_%s", i+1, len(pending), m.Version, m.Name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			done, err := lockMigrations(tx, m.Version)
+			if err != nil || done {
+				return err
+			}
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// MigrateDown откатывает steps последних примененных миграций.
+// В режиме dryRun только выводит список
+func MigrateDown(db *gorm.DB, steps int, dryRun bool) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := AppliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	var rollback []Migration
+	for i := len(migrations) - 1; i >= 0 && len(rollback) < steps; i-- {
+		if applied[migrations[i].Version] {
+			rollback = append(rollback, migrations[i])
+		}
+	}
+
+	reverted := 0
+	for i, m := range rollback {
+		log.Printf("[%d/%d] Reverting %04d_%s", i+1, len(rollback), m.Version, m.Name)
+		if dryRun {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			stillApplied, err := lockMigrations(tx, m.Version)
+			if err != nil || !stillApplied {
+				return err
+			}
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// lockMigrations берет advisory-блокировку до конца транзакции и сообщает, применена ли версия сейчас:
+// пока мы ждали блокировку, другой процесс мог ее применить или откатить
+func lockMigrations(tx *gorm.DB, version int) (bool, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+		return false, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+
+	var row SchemaMigration
+	err := tx.Where("version = ?", version).First(&row).Error
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return false, err
+}
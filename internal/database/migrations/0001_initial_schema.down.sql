@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS user_subscriptions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS user_actions;
+DROP TABLE IF EXISTS pin_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS pins;
+DROP TABLE IF EXISTS users;
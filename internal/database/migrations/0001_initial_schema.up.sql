@@ -0,0 +1,84 @@
+-- Исходная схема. IF NOT EXISTS позволяет применить миграцию к базе, созданной вручную до появления миграций
+
+CREATE TABLE IF NOT EXISTS users (
+    id           SERIAL PRIMARY KEY,
+    nickname     TEXT        NOT NULL,
+    description  TEXT        NOT NULL DEFAULT '',
+    hidden       BOOLEAN     NOT NULL DEFAULT FALSE,
+    private      BOOLEAN     NOT NULL DEFAULT FALSE,
+    verification BOOLEAN     NOT NULL DEFAULT FALSE,
+    name         TEXT        NOT NULL DEFAULT '',
+    surname      TEXT        NOT NULL DEFAULT '',
+    birth        TIMESTAMPTZ,
+    sex          TEXT        NOT NULL DEFAULT '',
+    country      TEXT,
+    lang         TEXT,
+    mentions     TEXT,
+    comment      BOOLEAN     NOT NULL DEFAULT TRUE,
+    autoplay     BOOLEAN     NOT NULL DEFAULT TRUE,
+    two_fa       BOOLEAN     NOT NULL DEFAULT FALSE,
+    email        TEXT        NOT NULL,
+    password     TEXT        NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS pins (
+    id                 SERIAL PRIMARY KEY,
+    path               TEXT        NOT NULL,
+    description        TEXT        NOT NULL DEFAULT '',
+    user_id            INTEGER     NOT NULL,
+    original           TEXT,
+    comment            BOOLEAN,
+    ai                 BOOLEAN,
+    type               TEXT,
+    title              TEXT        NOT NULL DEFAULT '',
+    width              INTEGER,
+    height             INTEGER,
+    duration           DOUBLE PRECISION,
+    original_file_name TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id          SERIAL PRIMARY KEY,
+    title_model TEXT        NOT NULL,
+    title_en    TEXT        NOT NULL DEFAULT '',
+    title_ru    TEXT        NOT NULL DEFAULT '',
+    count       INTEGER     NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS pin_tags (
+    id         SERIAL PRIMARY KEY,
+    pin_id     INTEGER     NOT NULL,
+    tag_id     INTEGER     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_actions (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL,
+    pin_id     INTEGER     NOT NULL,
+    action     TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER     NOT NULL,
+    pin_id      INTEGER     NOT NULL,
+    content     TEXT        NOT NULL,
+    reply_to_id INTEGER,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_subscriptions (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER     NOT NULL,
+    target_user_id INTEGER     NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,24 @@
+DROP INDEX IF EXISTS user_subscriptions_target_user_id_idx;
+DROP INDEX IF EXISTS comments_pin_id_idx;
+DROP INDEX IF EXISTS user_actions_pin_id_action_idx;
+DROP INDEX IF EXISTS pin_tags_tag_id_idx;
+DROP INDEX IF EXISTS pins_created_at_idx;
+DROP INDEX IF EXISTS pins_user_id_idx;
+
+DROP INDEX IF EXISTS user_subscriptions_user_id_target_user_id_key;
+DROP INDEX IF EXISTS user_actions_user_id_pin_id_action_key;
+DROP INDEX IF EXISTS pin_tags_pin_id_tag_id_key;
+DROP INDEX IF EXISTS tags_title_model_key;
+DROP INDEX IF EXISTS users_nickname_key;
+DROP INDEX IF EXISTS users_email_key;
+
+ALTER TABLE user_subscriptions DROP CONSTRAINT IF EXISTS user_subscriptions_target_user_id_fkey;
+ALTER TABLE user_subscriptions DROP CONSTRAINT IF EXISTS user_subscriptions_user_id_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_reply_to_id_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_pin_id_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_user_id_fkey;
+ALTER TABLE user_actions DROP CONSTRAINT IF EXISTS user_actions_pin_id_fkey;
+ALTER TABLE user_actions DROP CONSTRAINT IF EXISTS user_actions_user_id_fkey;
+ALTER TABLE pin_tags DROP CONSTRAINT IF EXISTS pin_tags_tag_id_fkey;
+ALTER TABLE pin_tags DROP CONSTRAINT IF EXISTS pin_tags_pin_id_fkey;
+ALTER TABLE pins DROP CONSTRAINT IF EXISTS pins_user_id_fkey;
@@ -0,0 +1,154 @@
+-- Внешние ключи и уникальность. В базах, созданных до миграций, сначала убираем
+-- висячие ссылки и дубликаты, иначе ограничения не создать.
+-- Сколько строк удалено, пишется в лог миграции через RAISE NOTICE
+
+-- Пользователей с одинаковым email или ником автоматически не объединить: миграция
+-- останавливается со списком конфликтов, их нужно разобрать вручную
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('email %L: users %s', email, ids), '; ') INTO conflicts
+    FROM (
+        SELECT email, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM users GROUP BY email HAVING COUNT(*) > 1
+    ) d;
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'duplicate users.email, resolve before migrating: %', conflicts;
+    END IF;
+
+    SELECT string_agg(format('nickname %L: users %s', nickname, ids), '; ') INTO conflicts
+    FROM (
+        SELECT nickname, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM users GROUP BY nickname HAVING COUNT(*) > 1
+    ) d;
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'duplicate users.nickname, resolve before migrating: %', conflicts;
+    END IF;
+END $$;
+
+DO $$
+DECLARE
+    n BIGINT;
+BEGIN
+    DELETE FROM pins WHERE user_id NOT IN (SELECT id FROM users);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'deleted % pins of missing users', n;
+
+    DELETE FROM pin_tags WHERE pin_id NOT IN (SELECT id FROM pins) OR tag_id NOT IN (SELECT id FROM tags);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'deleted % pin_tags of missing pins or tags', n;
+
+    DELETE FROM user_actions WHERE pin_id NOT IN (SELECT id FROM pins) OR user_id NOT IN (SELECT id FROM users);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'deleted % user_actions of missing pins or users', n;
+
+    DELETE FROM comments WHERE pin_id NOT IN (SELECT id FROM pins) OR user_id NOT IN (SELECT id FROM users);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'deleted % comments of missing pins or users', n;
+
+    UPDATE comments SET reply_to_id = NULL WHERE reply_to_id IS NOT NULL AND reply_to_id NOT IN (SELECT id FROM comments);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'detached % replies to missing comments', n;
+
+    DELETE FROM user_subscriptions WHERE user_id NOT IN (SELECT id FROM users) OR target_user_id NOT IN (SELECT id FROM users);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'deleted % user_subscriptions of missing users', n;
+END $$;
+
+-- Одинаковые теги сливаются в тег с наименьшим id, связи с пинами переносятся на него
+DO $$
+DECLARE
+    n BIGINT;
+BEGIN
+    CREATE TEMP TABLE tag_merges ON COMMIT DROP AS
+    SELECT t.id AS dup_id, k.keep_id
+    FROM tags t
+    JOIN (SELECT title_model, MIN(id) AS keep_id FROM tags GROUP BY title_model HAVING COUNT(*) > 1) k
+        ON k.title_model = t.title_model AND t.id <> k.keep_id;
+
+    -- Переводы берем у дубликата, если у оставшегося тега их нет
+    UPDATE tags SET
+        title_en = COALESCE(NULLIF(tags.title_en, ''), d.title_en, ''),
+        title_ru = COALESCE(NULLIF(tags.title_ru, ''), d.title_ru, ''),
+        updated_at = NOW()
+    FROM (
+        SELECT m.keep_id,
+            MAX(NULLIF(t.title_en, '')) AS title_en,
+            MAX(NULLIF(t.title_ru, '')) AS title_ru
+        FROM tag_merges m JOIN tags t ON t.id = m.dup_id
+        GROUP BY m.keep_id
+    ) d
+    WHERE tags.id = d.keep_id;
+
+    -- Связь с дубликатом удаляется, если пин уже связан с оставшимся тегом или с другим его дубликатом раньше
+    DELETE FROM pin_tags p USING tag_merges m
+    WHERE p.tag_id = m.dup_id AND EXISTS (
+        SELECT 1 FROM pin_tags q LEFT JOIN tag_merges qm ON qm.dup_id = q.tag_id
+        WHERE q.pin_id = p.pin_id AND COALESCE(qm.keep_id, q.tag_id) = m.keep_id
+            AND (qm.dup_id IS NULL OR q.id < p.id)
+    );
+    UPDATE pin_tags SET tag_id = m.keep_id FROM tag_merges m WHERE pin_tags.tag_id = m.dup_id;
+    UPDATE tags SET count = (SELECT COUNT(DISTINCT pin_id) FROM pin_tags WHERE pin_tags.tag_id = tags.id)
+    WHERE id IN (SELECT keep_id FROM tag_merges);
+
+    DELETE FROM tags WHERE id IN (SELECT dup_id FROM tag_merges);
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RAISE NOTICE 'merged % duplicate tags', n;
+END $$;
+
+DELETE FROM user_actions a USING user_actions b
+WHERE a.user_id = b.user_id AND a.pin_id = b.pin_id AND a.action = b.action AND a.id > b.id;
+DELETE FROM user_subscriptions a USING user_subscriptions b
+WHERE a.user_id = b.user_id AND a.target_user_id = b.target_user_id AND a.id > b.id;
+DELETE FROM pin_tags a USING pin_tags b
+WHERE a.pin_id = b.pin_id AND a.tag_id = b.tag_id AND a.id > b.id;
+
+ALTER TABLE pins DROP CONSTRAINT IF EXISTS pins_user_id_fkey;
+ALTER TABLE pins ADD CONSTRAINT pins_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE pin_tags DROP CONSTRAINT IF EXISTS pin_tags_pin_id_fkey;
+ALTER TABLE pin_tags ADD CONSTRAINT pin_tags_pin_id_fkey
+    FOREIGN KEY (pin_id) REFERENCES pins (id) ON DELETE CASCADE;
+ALTER TABLE pin_tags DROP CONSTRAINT IF EXISTS pin_tags_tag_id_fkey;
+ALTER TABLE pin_tags ADD CONSTRAINT pin_tags_tag_id_fkey
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE;
+
+ALTER TABLE user_actions DROP CONSTRAINT IF EXISTS user_actions_user_id_fkey;
+ALTER TABLE user_actions ADD CONSTRAINT user_actions_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE user_actions DROP CONSTRAINT IF EXISTS user_actions_pin_id_fkey;
+ALTER TABLE user_actions ADD CONSTRAINT user_actions_pin_id_fkey
+    FOREIGN KEY (pin_id) REFERENCES pins (id) ON DELETE CASCADE;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_user_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_pin_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_pin_id_fkey
+    FOREIGN KEY (pin_id) REFERENCES pins (id) ON DELETE CASCADE;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_reply_to_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_reply_to_id_fkey
+    FOREIGN KEY (reply_to_id) REFERENCES comments (id) ON DELETE SET NULL;
+
+ALTER TABLE user_subscriptions DROP CONSTRAINT IF EXISTS user_subscriptions_user_id_fkey;
+ALTER TABLE user_subscriptions ADD CONSTRAINT user_subscriptions_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE user_subscriptions DROP CONSTRAINT IF EXISTS user_subscriptions_target_user_id_fkey;
+ALTER TABLE user_subscriptions ADD CONSTRAINT user_subscriptions_target_user_id_fkey
+    FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS users_nickname_key ON users (nickname);
+CREATE UNIQUE INDEX IF NOT EXISTS tags_title_model_key ON tags (title_model);
+CREATE UNIQUE INDEX IF NOT EXISTS pin_tags_pin_id_tag_id_key ON pin_tags (pin_id, tag_id);
+CREATE UNIQUE INDEX IF NOT EXISTS user_actions_user_id_pin_id_action_key ON user_actions (user_id, pin_id, action);
+CREATE UNIQUE INDEX IF NOT EXISTS user_subscriptions_user_id_target_user_id_key ON user_subscriptions (user_id, target_user_id);
+
+CREATE INDEX IF NOT EXISTS pins_user_id_idx ON pins (user_id);
+CREATE INDEX IF NOT EXISTS pins_created_at_idx ON pins (created_at);
+CREATE INDEX IF NOT EXISTS pin_tags_tag_id_idx ON pin_tags (tag_id);
+CREATE INDEX IF NOT EXISTS user_actions_pin_id_action_idx ON user_actions (pin_id, action);
+CREATE INDEX IF NOT EXISTS comments_pin_id_idx ON comments (pin_id);
+CREATE INDEX IF NOT EXISTS user_subscriptions_target_user_id_idx ON user_subscriptions (target_user_id);
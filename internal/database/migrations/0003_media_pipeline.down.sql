@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS pin_renditions;
+
+DROP INDEX IF EXISTS pins_duplicate_of_id_idx;
+ALTER TABLE pins DROP CONSTRAINT IF EXISTS pins_duplicate_of_id_fkey;
+ALTER TABLE pins DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE pins DROP COLUMN IF EXISTS palette;
+ALTER TABLE pins DROP COLUMN IF EXISTS duplicate_of_id;
+ALTER TABLE pins DROP COLUMN IF EXISTS phash;
+
+ALTER TABLE users DROP COLUMN IF EXISTS admin;
@@ -0,0 +1,24 @@
+-- Копии изображений, перцептивные хэши, палитра и роль администратора
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS phash BIGINT;
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS duplicate_of_id INTEGER;
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS palette JSONB;
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS blurhash TEXT;
+
+ALTER TABLE pins DROP CONSTRAINT IF EXISTS pins_duplicate_of_id_fkey;
+ALTER TABLE pins ADD CONSTRAINT pins_duplicate_of_id_fkey
+    FOREIGN KEY (duplicate_of_id) REFERENCES pins (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS pins_duplicate_of_id_idx ON pins (duplicate_of_id);
+
+CREATE TABLE IF NOT EXISTS pin_renditions (
+    id         SERIAL PRIMARY KEY,
+    pin_id     INTEGER     NOT NULL REFERENCES pins (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL,
+    key        TEXT        NOT NULL,
+    width      INTEGER     NOT NULL,
+    height     INTEGER     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS pin_renditions_pin_id_name_key ON pin_renditions (pin_id, name);
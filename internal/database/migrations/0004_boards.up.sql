@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS boards (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title       TEXT        NOT NULL,
+    description TEXT        NOT NULL DEFAULT '',
+    secret      BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS boards_user_id_idx ON boards (user_id);
+
+CREATE TABLE IF NOT EXISTS board_pins (
+    id         SERIAL PRIMARY KEY,
+    board_id   INTEGER     NOT NULL REFERENCES boards (id) ON DELETE CASCADE,
+    pin_id     INTEGER     NOT NULL REFERENCES pins (id) ON DELETE CASCADE,
+    position   INTEGER     NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS board_pins_board_id_pin_id_key ON board_pins (board_id, pin_id);
+CREATE INDEX IF NOT EXISTS board_pins_pin_id_idx ON board_pins (pin_id);
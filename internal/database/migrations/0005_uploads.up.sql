@@ -0,0 +1,14 @@
+-- Состояние возобновляемых (tus) загрузок
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id            TEXT PRIMARY KEY,
+    user_id       INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    length        BIGINT      NOT NULL,
+    upload_offset BIGINT      NOT NULL DEFAULT 0,
+    metadata      JSONB,
+    pin_id        INTEGER     REFERENCES pins (id) ON DELETE SET NULL,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON uploads (expires_at);
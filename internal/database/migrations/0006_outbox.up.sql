@@ -0,0 +1,12 @@
+-- Outbox изменений пинов для синхронизации поискового индекса
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id           SERIAL PRIMARY KEY,
+    event        TEXT        NOT NULL,
+    pin_id       INTEGER     NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS outbox_events_available_at_idx ON outbox_events (available_at, id);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS comments_pin_stats ON comments;
+DROP TRIGGER IF EXISTS user_actions_pin_stats ON user_actions;
+DROP FUNCTION IF EXISTS mark_pin_stats_changed();
+DROP INDEX IF EXISTS pins_stats_changed_at_idx;
+ALTER TABLE pins DROP COLUMN IF EXISTS stats_synced_at;
+ALTER TABLE pins DROP COLUMN IF EXISTS stats_changed_at;
@@ -0,0 +1,31 @@
+-- Метки изменения лайков, сохранений и комментариев пина для периодической синхронизации счетчиков в поисковый индекс.
+-- Пин нужно синхронизировать, если stats_changed_at позже stats_synced_at
+
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS stats_changed_at TIMESTAMPTZ;
+ALTER TABLE pins ADD COLUMN IF NOT EXISTS stats_synced_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS pins_stats_changed_at_idx ON pins (stats_changed_at) WHERE stats_changed_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION mark_pin_stats_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE pins SET stats_changed_at = NOW() WHERE id = OLD.pin_id;
+        RETURN OLD;
+    END IF;
+    UPDATE pins SET stats_changed_at = NOW() WHERE id = NEW.pin_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_actions_pin_stats ON user_actions;
+CREATE TRIGGER user_actions_pin_stats
+    AFTER INSERT OR DELETE ON user_actions
+    FOR EACH ROW EXECUTE FUNCTION mark_pin_stats_changed();
+
+DROP TRIGGER IF EXISTS comments_pin_stats ON comments;
+CREATE TRIGGER comments_pin_stats
+    AFTER INSERT OR DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION mark_pin_stats_changed();
+
+-- Первая синхронизация переносит в индекс счетчики всех пинов, у которых они уже есть
+UPDATE pins SET stats_changed_at = NOW()
+WHERE id IN (SELECT pin_id FROM user_actions UNION SELECT pin_id FROM comments);
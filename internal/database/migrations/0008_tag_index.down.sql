@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tags_updated_at_idx;
+ALTER TABLE tags DROP COLUMN IF EXISTS indexed_at;
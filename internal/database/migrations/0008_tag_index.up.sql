@@ -0,0 +1,5 @@
+-- Момент, на котором тег последний раз попал в индекс подсказок. Тег нужно переиндексировать,
+-- если updated_at позже indexed_at: его создали, переименовали или изменился счетчик
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS indexed_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS tags_updated_at_idx ON tags (updated_at);
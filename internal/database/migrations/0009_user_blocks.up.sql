@@ -0,0 +1,9 @@
+-- Блокировки: пины заблокированных авторов не попадают в рекомендации пользователя
+
+CREATE TABLE IF NOT EXISTS user_blocks (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    target_user_id INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS user_blocks_user_id_target_user_id_key ON user_blocks (user_id, target_user_id);
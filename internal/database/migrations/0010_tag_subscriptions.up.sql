@@ -0,0 +1,12 @@
+-- Подписки на теги: пины с тегами из подписок попадают в домашнюю ленту
+
+CREATE TABLE IF NOT EXISTS tag_subscriptions (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    tag_id     INTEGER     NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS tag_subscriptions_user_id_tag_id_key ON tag_subscriptions (user_id, tag_id);
+
+-- Лента читает пины подписок от новых к старым
+CREATE INDEX IF NOT EXISTS pins_user_id_created_at_idx ON pins (user_id, created_at DESC, id DESC);
@@ -0,0 +1,4 @@
+-- Версия ленты пользователя: растет при изменении подписок и блокировок.
+-- Реплики сверяют с ней свой кэш лент, поэтому сброс виден всем сразу
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS feed_version BIGINT NOT NULL DEFAULT 0;
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"pornterest/internal/media"
 	"pornterest/internal/models"
 
 	"github.com/elastic/go-elasticsearch/v8"
@@ -33,56 +34,111 @@ func NewESClient(addresses []string) (*ESClient, error) {
 	return &ESClient{client: client}, nil
 }
 
+// CreateIndex создает физический индекс с текущим PinMapping. Для существующего индекса
+// только добавляет в него новые поля
 func (es *ESClient) CreateIndex(ctx context.Context, indexName string) error {
-	res, err := es.client.Indices.Exists([]string{indexName})
+	return es.createIndex(ctx, indexName, PinMapping)
+}
+
+// createIndex создает индекс с заданными настройками и маппингом или обновляет маппинг существующего
+func (es *ESClient) createIndex(ctx context.Context, indexName, mapping string) error {
+	exists, err := es.indexExists(ctx, indexName)
 	if err != nil {
 		return err
 	}
+	if exists {
+		return es.updateMapping(ctx, indexName, mapping)
+	}
 
-	if res.StatusCode == 404 {
-		res, err = es.client.Indices.Create(
-			indexName,
-			es.client.Indices.Create.WithBody(strings.NewReader(PinMapping)),
-		)
-		if err != nil {
-			return err
-		}
-		if res.IsError() {
-			return fmt.Errorf("error creating index: %s", res.String())
-		}
+	res, err := es.client.Indices.Create(
+		indexName,
+		es.client.Indices.Create.WithBody(strings.NewReader(mapping)),
+		es.client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
 	}
+	defer res.Body.Close()
 
+	if res.IsError() {
+		return fmt.Errorf("error creating index: %s", res.String())
+	}
 	return nil
 }
 
-type PinDocument struct {
-	ID               int           `json:"id"`
-	Title            string        `json:"title"`
-	Description      string        `json:"description"`
-	Original         string        `json:"original,omitempty"`
-	OriginalFileName string        `json:"original_file_name,omitempty"`
-	Path             string        `json:"path"`
-	Type             string        `json:"type"`
-	Tags             []TagDocument `json:"tags"`
-	CreatedAt        time.Time     `json:"created_at"`
-	UpdatedAt        time.Time     `json:"updated_at"`
+// updateMapping добавляет в существующий индекс поля, появившиеся в маппинге после его создания.
+// Изменить тип уже существующего поля так нельзя — для этого индекс нужно пересоздать
+func (es *ESClient) updateMapping(ctx context.Context, indexName, mappingJSON string) error {
+	var mapping struct {
+		Mappings json.RawMessage `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(mappingJSON), &mapping); err != nil {
+		return fmt.Errorf("error parsing mapping: %v", err)
+	}
+
+	res, err := es.client.Indices.PutMapping(
+		[]string{indexName},
+		bytes.NewReader(mapping.Mappings),
+		es.client.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error updating mapping: %s", res.String())
+	}
+	return nil
 }
 
-type TagDocument struct {
-	TitleEN string `json:"title_en"`
-	TitleRU string `json:"title_ru"`
+type PinDocument struct {
+	ID               int             `json:"id"`
+	Title            string          `json:"title"`
+	Description      string          `json:"description"`
+	Original         string          `json:"original,omitempty"`
+	OriginalFileName string          `json:"original_file_name,omitempty"`
+	Path             string          `json:"path"`
+	Type             string          `json:"type"`
+	AI               bool            `json:"ai"`
+	UserID           int             `json:"user_id"`
+	Width            *int            `json:"width,omitempty"`
+	Height           *int            `json:"height,omitempty"`
+	Orientation      string          `json:"orientation,omitempty"`
+	Duration         *float64        `json:"duration,omitempty"`
+	Tags             []TagDocument   `json:"tags"`
+	SuggestText      string          `json:"suggest_text,omitempty"` // название и названия тегов — словарь подсказок "возможно, вы искали"
+	Palette          []string        `json:"palette,omitempty"`
+	BlurHash         string          `json:"blurhash,omitempty"`
+	Colors           []ColorDocument `json:"colors,omitempty"`
+	Likes            int             `json:"likes"`
+	Saves            int             `json:"saves"`
+	Comments         int             `json:"comments"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
 }
 
-func (es *ESClient) IndexPin(ctx context.Context, pin *models.Pin, tags []models.Tag) error {
-	if pin == nil {
-		return fmt.Errorf("pin cannot be nil")
-	}
+// PinStats — счетчики вовлеченности пина для сортировки выдачи
+type PinStats struct {
+	Likes    int `json:"likes"`
+	Saves    int `json:"saves"`
+	Comments int `json:"comments"`
+}
 
+// NewPinDocument собирает документ индекса из пина, его тегов и счетчиков
+func NewPinDocument(pin *models.Pin, tags []models.Tag, stats PinStats) PinDocument {
 	pinDoc := PinDocument{
 		ID:          pin.ID,
 		Title:       pin.Title,
 		Description: pin.Description,
 		Path:        pin.Path,
+		UserID:      pin.UserID,
+		Width:       pin.Width,
+		Height:      pin.Height,
+		Duration:    pin.Duration,
+		Likes:       stats.Likes,
+		Saves:       stats.Saves,
+		Comments:    stats.Comments,
 		CreatedAt:   pin.CreatedAt,
 		UpdatedAt:   pin.UpdatedAt,
 	}
@@ -93,28 +149,133 @@ func (es *ESClient) IndexPin(ctx context.Context, pin *models.Pin, tags []models
 	if pin.Type != nil {
 		pinDoc.Type = *pin.Type
 	}
+	if pin.BlurHash != nil {
+		pinDoc.BlurHash = *pin.BlurHash
+	}
+	if pin.Ai != nil {
+		pinDoc.AI = *pin.Ai
+	}
+	if pin.Width != nil && pin.Height != nil {
+		pinDoc.Orientation = Orientation(*pin.Width, *pin.Height)
+	}
+
+	pinDoc.Palette = pin.Palette
+	for _, hex := range pin.Palette {
+		lab, err := media.HexToLab(hex)
+		if err != nil {
+			continue
+		}
+		pinDoc.Colors = append(pinDoc.Colors, ColorDocument{Hex: hex, L: lab.L, A: lab.A, B: lab.B})
+	}
+
+	suggestText := []string{pin.Title}
 
 	// Инициализируем пустой слайс тегов, если tags == nil
 	pinDoc.Tags = make([]TagDocument, 0)
 	if len(tags) > 0 {
 		pinDoc.Tags = make([]TagDocument, len(tags))
 		for i, tag := range tags {
+			suggestText = append(suggestText, tag.TitleEN, tag.TitleRU)
 			pinDoc.Tags[i] = TagDocument{
-				TitleEN: tag.TitleEN,
-				TitleRU: tag.TitleRU,
+				ID:         tag.ID,
+				TitleModel: tag.TitleModel,
+				TitleEN:    tag.TitleEN,
+				TitleRU:    tag.TitleRU,
 			}
 		}
 	}
+	pinDoc.SuggestText = strings.TrimSpace(strings.Join(suggestText, " "))
+
+	return pinDoc
+}
+
+type TagDocument struct {
+	ID         int    `json:"id"`
+	TitleModel string `json:"title_model"`
+	TitleEN    string `json:"title_en"`
+	TitleRU    string `json:"title_ru"`
+}
+
+// ColorDocument — цвет палитры в пространстве CIELAB для поиска по цвету
+type ColorDocument struct {
+	Hex string  `json:"hex"`
+	L   float64 `json:"l"`
+	A   float64 `json:"a"`
+	B   float64 `json:"b"`
+}
+
+// ColorMatchDistance — максимальное расстояние ΔE между искомым цветом и цветом палитры пина
+const ColorMatchDistance = 20
+
+// Ориентация медиа по соотношению сторон
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+// squareTolerance — насколько стороны могут отличаться, чтобы медиа еще считалось квадратным
+const squareTolerance = 0.05
+
+// Orientation определяет ориентацию по размерам; почти равные стороны считаются квадратом
+func Orientation(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return ""
+	}
+	ratio := float64(width) / float64(height)
+	switch {
+	case ratio > 1+squareTolerance:
+		return OrientationLandscape
+	case ratio < 1-squareTolerance:
+		return OrientationPortrait
+	default:
+		return OrientationSquare
+	}
+}
+
+// PinSearchFilters — ограничения, накладываемые на результаты поиска. Нулевые поля не ограничивают
+type PinSearchFilters struct {
+	// Color — искомый цвет; пин подходит, если хотя бы один цвет его палитры ближе ColorMatchDistance
+	Color *media.Lab
+	// Types — допустимые типы медиа (image, gif, video)
+	Types       []string
+	AI          *bool
+	UserID      *int
+	CreatedFrom *time.Time
+	// CreatedTo — верхняя граница даты создания, не включительно
+	CreatedTo   *time.Time
+	MinWidth    *int
+	MaxWidth    *int
+	MinHeight   *int
+	MaxHeight   *int
+	Orientation string
+	// MinDuration и MaxDuration — длительность видео в секундах
+	MinDuration *float64
+	MaxDuration *float64
+}
+
+// IsEmpty сообщает, что фильтры не заданы
+func (f PinSearchFilters) IsEmpty() bool {
+	return f.Color == nil && len(f.Types) == 0 && f.AI == nil && f.UserID == nil &&
+		f.CreatedFrom == nil && f.CreatedTo == nil &&
+		f.MinWidth == nil && f.MaxWidth == nil && f.MinHeight == nil && f.MaxHeight == nil &&
+		f.Orientation == "" && f.MinDuration == nil && f.MaxDuration == nil
+}
+
+func (es *ESClient) IndexPin(ctx context.Context, pin *models.Pin, tags []models.Tag, stats PinStats) error {
+	if pin == nil {
+		return fmt.Errorf("pin cannot be nil")
+	}
+
+	pinDoc := NewPinDocument(pin, tags, stats)
 
 	data, err := json.Marshal(pinDoc)
 	if err != nil {
 		return fmt.Errorf("error marshaling document: %v", err)
 	}
 
-	log.Printf("Indexing pin %d with data: %s", pin.ID, string(data))
-
 	res, err := es.client.Index(
-		"pins",
+		PinsAlias,
 		bytes.NewReader(data),
 		es.client.Index.WithDocumentID(strconv.Itoa(pin.ID)),
 		es.client.Index.WithContext(ctx),
@@ -122,6 +283,7 @@ func (es *ESClient) IndexPin(ctx context.Context, pin *models.Pin, tags []models
 	if err != nil {
 		return fmt.Errorf("error indexing pin %d: %v", pin.ID, err)
 	}
+	defer res.Body.Close()
 
 	if res.IsError() {
 		body, _ := io.ReadAll(res.Body)
@@ -132,292 +294,62 @@ func (es *ESClient) IndexPin(ctx context.Context, pin *models.Pin, tags []models
 	return nil
 }
 
-func (es *ESClient) SearchPins(ctx context.Context, query string, tags []string) ([]PinDocument, error) {
-	searchQuery := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"nested": map[string]interface{}{
-							"path": "tags",
-							"query": map[string]interface{}{
-								"bool": map[string]interface{}{
-									"should": []map[string]interface{}{
-										{
-											"match": map[string]interface{}{
-												"tags.title_ru": map[string]interface{}{
-													"query":     query,
-													"fuzziness": "AUTO",
-													"boost":     3,
-												},
-											},
-										},
-										{
-											"match": map[string]interface{}{
-												"tags.title_en": map[string]interface{}{
-													"query":     query,
-													"fuzziness": "AUTO",
-													"boost":     2,
-												},
-											},
-										},
-										{
-											"match_phrase_prefix": map[string]interface{}{
-												"tags.title_ru": map[string]interface{}{
-													"query": query,
-													"boost": 2,
-												},
-											},
-										},
-										{
-											"match_phrase_prefix": map[string]interface{}{
-												"tags.title_en": map[string]interface{}{
-													"query": query,
-													"boost": 1,
-												},
-											},
-										},
-									},
-								},
-							},
-							"score_mode": "max",
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"original_file_name": map[string]interface{}{
-								"query":         query,
-								"fuzziness":     "AUTO",
-								"prefix_length": 2,
-								"boost":         2,
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"title": map[string]interface{}{
-								"query":     query,
-								"fuzziness": "AUTO",
-								"boost":     3,
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"description": map[string]interface{}{
-								"query":     query,
-								"fuzziness": "AUTO",
-								"boost":     1,
-							},
-						},
-					},
-					{
-						"match_phrase": map[string]interface{}{
-							"description": map[string]interface{}{
-								"query": query,
-								"boost": 2,
-							},
-						},
-					},
-				},
-				"minimum_should_match": 1,
-			},
-		},
-		"highlight": map[string]interface{}{
-			"fields": map[string]interface{}{
-				"original_file_name": map[string]interface{}{},
-				"title":              map[string]interface{}{},
-				"description":        map[string]interface{}{},
-				"tags.title_ru":      map[string]interface{}{},
-				"tags.title_en":      map[string]interface{}{},
-			},
-		},
-	}
-
-	if len(tags) > 0 {
-		tagQueries := make([]map[string]interface{}, len(tags))
-		for i, tag := range tags {
-			tagQueries[i] = map[string]interface{}{
-				"nested": map[string]interface{}{
-					"path": "tags",
-					"query": map[string]interface{}{
-						"bool": map[string]interface{}{
-							"should": []map[string]interface{}{
-								{
-									"match": map[string]interface{}{
-										"tags.title_ru": tag,
-									},
-								},
-								{
-									"match": map[string]interface{}{
-										"tags.title_en": tag,
-									},
-								},
-							},
-						},
-					},
-				},
-			}
-		}
-		searchQuery["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"] = tagQueries
-	}
-
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, fmt.Errorf("error encoding query: %v", err)
-	}
-
-	log.Printf("Search query: %s", buf.String())
-
-	res, err := es.client.Search(
-		es.client.Search.WithContext(ctx),
-		es.client.Search.WithIndex("pins"),
-		es.client.Search.WithBody(&buf),
-		es.client.Search.WithTrackTotalHits(true),
+// DeletePin удаляет документ пина из индекса. Отсутствие документа ошибкой не считается
+func (es *ESClient) DeletePin(ctx context.Context, pinID int) error {
+	res, err := es.client.Delete(
+		PinsAlias,
+		strconv.Itoa(pinID),
+		es.client.Delete.WithContext(ctx),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error searching: %v", err)
+		return fmt.Errorf("error deleting pin %d: %v", pinID, err)
 	}
+	defer res.Body.Close()
 
-	if res.IsError() {
+	if res.IsError() && res.StatusCode != 404 {
 		body, _ := io.ReadAll(res.Body)
-		return nil, fmt.Errorf("search error: %s", string(body))
+		return fmt.Errorf("error deleting pin %d: %s", pinID, string(body))
 	}
 
-	var result struct {
-		Hits struct {
-			Total struct {
-				Value int `json:"value"`
-			} `json:"total"`
-			Hits []struct {
-				Source    PinDocument         `json:"_source"`
-				Score     float64             `json:"_score"`
-				Highlight map[string][]string `json:"highlight"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("error parsing response: %v", err)
-	}
-
-	log.Printf("Found %d documents", result.Hits.Total.Value)
+	log.Printf("Successfully deleted pin %d from index", pinID)
+	return nil
+}
 
-	pins := make([]PinDocument, len(result.Hits.Hits))
-	for i, hit := range result.Hits.Hits {
-		pins[i] = hit.Source
-		log.Printf("Document %d: score=%f", hit.Source.ID, hit.Score)
-		if len(hit.Highlight) > 0 {
-			log.Printf("Highlights for document %d: %v", hit.Source.ID, hit.Highlight)
-		}
+// colorFilter отбирает пины, в палитре которых есть цвет не дальше distance от заданного.
+// Диапазоны по осям L, a, b быстро отсекают явно далекие цвета, скрипт проверяет точное ΔE
+func colorFilter(color media.Lab, distance float64) map[string]interface{} {
+	axisRange := func(v float64) map[string]interface{} {
+		return map[string]interface{}{"gte": v - distance, "lte": v + distance}
 	}
 
-	return pins, nil
-}
-
-func (es *ESClient) SearchPinIDs(ctx context.Context, query string) ([]int, int, error) {
-	searchQuery := map[string]interface{}{
-		"_source": []string{"id"},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"nested": map[string]interface{}{
-							"path": "tags",
-							"query": map[string]interface{}{
-								"bool": map[string]interface{}{
-									"should": []map[string]interface{}{
-										{
-											"match": map[string]interface{}{
-												"tags.title_ru": map[string]interface{}{
-													"query":     query,
-													"fuzziness": "AUTO",
-													"boost":     3,
-												},
-											},
-										},
-										{
-											"match": map[string]interface{}{
-												"tags.title_en": map[string]interface{}{
-													"query":     query,
-													"fuzziness": "AUTO",
-													"boost":     2,
-												},
-											},
-										},
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path": "colors",
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"filter": []map[string]interface{}{
+						{"range": map[string]interface{}{"colors.l": axisRange(color.L)}},
+						{"range": map[string]interface{}{"colors.a": axisRange(color.A)}},
+						{"range": map[string]interface{}{"colors.b": axisRange(color.B)}},
+						{
+							"script": map[string]interface{}{
+								"script": map[string]interface{}{
+									"source": "double dl = doc['colors.l'].value - params.l; " +
+										"double da = doc['colors.a'].value - params.a; " +
+										"double db = doc['colors.b'].value - params.b; " +
+										"return dl * dl + da * da + db * db <= params.d * params.d;",
+									"params": map[string]interface{}{
+										"l": color.L,
+										"a": color.A,
+										"b": color.B,
+										"d": distance,
 									},
 								},
 							},
-							"score_mode": "max",
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"title": map[string]interface{}{
-								"query":     query,
-								"fuzziness": "AUTO",
-								"boost":     3,
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"description": map[string]interface{}{
-								"query":     query,
-								"fuzziness": "AUTO",
-								"boost":     1,
-							},
 						},
 					},
 				},
-				"minimum_should_match": 1,
 			},
 		},
 	}
-
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, 0, fmt.Errorf("error encoding query: %v", err)
-	}
-
-	res, err := es.client.Search(
-		es.client.Search.WithContext(ctx),
-		es.client.Search.WithIndex("pins"),
-		es.client.Search.WithBody(&buf),
-		es.client.Search.WithTrackTotalHits(true),
-		es.client.Search.WithSize(10000), // Увеличиваем размер выборки для получения всех ID
-	)
-	if err != nil {
-		return nil, 0, fmt.Errorf("error searching: %v", err)
-	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		body, _ := io.ReadAll(res.Body)
-		return nil, 0, fmt.Errorf("search error: %s", string(body))
-	}
-
-	var result struct {
-		Hits struct {
-			Total struct {
-				Value int `json:"value"`
-			} `json:"total"`
-			Hits []struct {
-				Source struct {
-					ID int `json:"id"`
-				} `json:"_source"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, 0, fmt.Errorf("error parsing response: %v", err)
-	}
-
-	pinIDs := make([]int, len(result.Hits.Hits))
-	for i, hit := range result.Hits.Hits {
-		pinIDs[i] = hit.Source.ID
-	}
-
-	return pinIDs, result.Hits.Total.Value, nil
 }
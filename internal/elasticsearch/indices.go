@@ -0,0 +1,463 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PinsAlias — алиас, через который API читает и пишет пины.
+// За ним стоит одна физическая версия индекса pins_vN
+const PinsAlias = "pins"
+
+// PinIndexName возвращает имя физического индекса пинов заданной версии
+func PinIndexName(version int) string {
+	return fmt.Sprintf("%s_v%d", PinsAlias, version)
+}
+
+// PinIndexVersion разбирает номер версии из имени физического индекса, ok=false для посторонних индексов
+func PinIndexVersion(index string) (version int, ok bool) {
+	suffix, found := strings.CutPrefix(index, PinsAlias+"_v")
+	if !found {
+		return 0, false
+	}
+	version, err := strconv.Atoi(suffix)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// EnsurePinIndex подготавливает индекс пинов при старте API.
+// Если алиаса еще нет, создается pins_v1 с алиасом pins. Если алиас есть, в индекс добавляются
+// новые поля PinMapping. Старый индекс с именем pins без алиаса не трогается — его заменит команда reindex
+func (es *ESClient) EnsurePinIndex(ctx context.Context) error {
+	targets, err := es.AliasTargets(ctx, PinsAlias)
+	if err != nil {
+		return err
+	}
+	exists := len(targets) > 0
+	if !exists {
+		if exists, err = es.indexExists(ctx, PinsAlias); err != nil {
+			return err
+		}
+	}
+	if exists {
+		return es.updateMapping(ctx, PinsAlias, PinMapping)
+	}
+
+	index := PinIndexName(1)
+	if err := es.CreateIndex(ctx, index); err != nil {
+		return err
+	}
+	return es.SwapAlias(ctx, PinsAlias, index, nil, false)
+}
+
+// AliasTargets возвращает физические индексы, на которые указывает алиас
+func (es *ESClient) AliasTargets(ctx context.Context, alias string) ([]string, error) {
+	res, err := es.client.Indices.GetAlias(
+		es.client.Indices.GetAlias.WithContext(ctx),
+		es.client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error getting alias %s: %s", alias, res.String())
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing alias response: %v", err)
+	}
+
+	targets := make([]string, 0, len(result))
+	for index := range result {
+		targets = append(targets, index)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// PinIndexVersions возвращает номера существующих версий индекса пинов по возрастанию
+func (es *ESClient) PinIndexVersions(ctx context.Context) ([]int, error) {
+	res, err := es.client.Indices.Get(
+		[]string{PinsAlias + "_v*"},
+		es.client.Indices.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error listing indices: %s", res.String())
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing indices response: %v", err)
+	}
+
+	var versions []int
+	for index := range result {
+		if version, ok := PinIndexVersion(index); ok {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// SetBulkLoadMode отключает обновление и реплики индекса на время массовой загрузки и возвращает их обратно
+func (es *ESClient) SetBulkLoadMode(ctx context.Context, index string, enabled bool) error {
+	settings := `{"index": {"refresh_interval": null, "number_of_replicas": null}}`
+	if enabled {
+		settings = `{"index": {"refresh_interval": "-1", "number_of_replicas": 0}}`
+	}
+
+	res, err := es.client.Indices.PutSettings(
+		strings.NewReader(settings),
+		es.client.Indices.PutSettings.WithContext(ctx),
+		es.client.Indices.PutSettings.WithIndex(index),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error updating settings of %s: %s", index, res.String())
+	}
+	return nil
+}
+
+// BulkIndexPins индексирует документы одним запросом Bulk API в указанный физический индекс
+func (es *ESClient) BulkIndexPins(ctx context.Context, index string, docs []PinDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		meta := map[string]interface{}{
+			"index": map[string]interface{}{
+				"_index": index,
+				"_id":    strconv.Itoa(doc.ID),
+			},
+		}
+		if err := enc.Encode(meta); err != nil {
+			return fmt.Errorf("error encoding bulk action: %v", err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("error encoding document %d: %v", doc.ID, err)
+		}
+	}
+
+	return es.sendBulk(ctx, &buf, len(docs), false)
+}
+
+// BulkDeletePins удаляет документы пинов из указанного физического индекса. Отсутствующие документы пропускаются
+func (es *ESClient) BulkDeletePins(ctx context.Context, index string, pinIDs []int) error {
+	if len(pinIDs) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, pinID := range pinIDs {
+		meta := map[string]interface{}{
+			"delete": map[string]interface{}{
+				"_index": index,
+				"_id":    strconv.Itoa(pinID),
+			},
+		}
+		if err := enc.Encode(meta); err != nil {
+			return fmt.Errorf("error encoding bulk action: %v", err)
+		}
+	}
+
+	return es.sendBulk(ctx, &buf, len(pinIDs), true)
+}
+
+// PinDocumentIDs возвращает до size id пинов из индекса, больших afterID, по возрастанию.
+// Видны только документы, попавшие в индекс до последнего обновления (refresh)
+func (es *ESClient) PinDocumentIDs(ctx context.Context, index string, afterID, size int) ([]int, error) {
+	body := map[string]interface{}{
+		"_source": []string{"id"},
+		"size":    size,
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{"id": map[string]interface{}{"gt": afterID}},
+		},
+		"sort": []map[string]interface{}{{"id": "asc"}},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("error encoding query: %v", err)
+	}
+
+	res, err := es.client.Search(
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithIndex(index),
+		es.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing documents of %s: %v", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("error listing documents of %s: %s", index, string(body))
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					ID int `json:"id"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	ids := make([]int, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		ids[i] = hit.Source.ID
+	}
+	return ids, nil
+}
+
+// UpdatePinStats обновляет счетчики вовлеченности в документах пинов частичным обновлением.
+// Пины, которых еще нет в индексе, пропускаются: счетчики попадут в документ при его индексации
+func (es *ESClient) UpdatePinStats(ctx context.Context, stats map[int]PinStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for pinID, s := range stats {
+		meta := map[string]interface{}{
+			"update": map[string]interface{}{
+				"_index": PinsAlias,
+				"_id":    strconv.Itoa(pinID),
+			},
+		}
+		if err := enc.Encode(meta); err != nil {
+			return fmt.Errorf("error encoding bulk action: %v", err)
+		}
+		if err := enc.Encode(map[string]interface{}{"doc": s}); err != nil {
+			return fmt.Errorf("error encoding stats of pin %d: %v", pinID, err)
+		}
+	}
+
+	return es.sendBulk(ctx, &buf, len(stats), true)
+}
+
+// sendBulk отправляет тело Bulk API и проверяет результат каждой операции.
+// ignoreMissing не считает ошибкой 404 — обновление документа, которого нет в индексе
+func (es *ESClient) sendBulk(ctx context.Context, body io.Reader, count int, ignoreMissing bool) error {
+	res, err := es.client.Bulk(
+		body,
+		es.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error sending bulk request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bulk request failed: %s", string(body))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error parsing bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, op := range item {
+			if op.Status == 404 && ignoreMissing {
+				continue
+			}
+			if op.Status >= 300 {
+				if failed == 0 {
+					first = fmt.Sprintf("document %s: %s", op.ID, string(op.Error))
+				}
+				failed++
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("bulk request failed for %d of %d documents, first error: %s", failed, count, first)
+}
+
+// RefreshIndex делает проиндексированные документы видимыми для поиска и подсчета
+func (es *ESClient) RefreshIndex(ctx context.Context, index string) error {
+	res, err := es.client.Indices.Refresh(
+		es.client.Indices.Refresh.WithContext(ctx),
+		es.client.Indices.Refresh.WithIndex(index),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error refreshing %s: %s", index, res.String())
+	}
+	return nil
+}
+
+// CountDocuments возвращает количество документов в индексе
+func (es *ESClient) CountDocuments(ctx context.Context, index string) (int, error) {
+	res, err := es.client.Count(
+		es.client.Count.WithContext(ctx),
+		es.client.Count.WithIndex(index),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("error counting documents in %s: %s", index, res.String())
+	}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error parsing count response: %v", err)
+	}
+	return result.Count, nil
+}
+
+// SwapAlias одним атомарным запросом переводит алиас на newIndex и снимает его со старых индексов.
+// Если dropLegacy, удаляет физический индекс с именем самого алиаса, оставшийся с времен до версионирования
+func (es *ESClient) SwapAlias(ctx context.Context, alias, newIndex string, oldIndices []string, dropLegacy bool) error {
+	var actions []map[string]interface{}
+	if dropLegacy {
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": alias},
+		})
+	}
+	for _, index := range oldIndices {
+		if index == newIndex {
+			continue
+		}
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": index, "alias": alias},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": newIndex, "alias": alias},
+	})
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"actions": actions}); err != nil {
+		return fmt.Errorf("error encoding alias actions: %v", err)
+	}
+
+	res, err := es.client.Indices.UpdateAliases(
+		&buf,
+		es.client.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error swapping alias %s: %s", alias, res.String())
+	}
+	return nil
+}
+
+// DeleteIndices удаляет физические индексы; отсутствующие пропускаются
+func (es *ESClient) DeleteIndices(ctx context.Context, indices []string) error {
+	if len(indices) == 0 {
+		return nil
+	}
+
+	res, err := es.client.Indices.Delete(
+		indices,
+		es.client.Indices.Delete.WithContext(ctx),
+		es.client.Indices.Delete.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error deleting indices %v: %s", indices, res.String())
+	}
+	return nil
+}
+
+// LegacyPinIndexExists сообщает, остался ли физический индекс pins, созданный до версионирования
+func (es *ESClient) LegacyPinIndexExists(ctx context.Context) (bool, error) {
+	targets, err := es.AliasTargets(ctx, PinsAlias)
+	if err != nil {
+		return false, err
+	}
+	if len(targets) > 0 {
+		return false, nil
+	}
+	return es.indexExists(ctx, PinsAlias)
+}
+
+func (es *ESClient) indexExists(ctx context.Context, index string) (bool, error) {
+	res, err := es.client.Indices.Exists(
+		[]string{index},
+		es.client.Indices.Exists.WithContext(ctx),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf("error checking index %s: %s", index, res.String())
+	}
+}
@@ -65,9 +65,17 @@ const PinMapping = `{
                 },
                 "path": { "type": "keyword" },
                 "type": { "type": "keyword" },
+                "ai": { "type": "boolean" },
+                "user_id": { "type": "integer" },
+                "width": { "type": "integer" },
+                "height": { "type": "integer" },
+                "orientation": { "type": "keyword" },
+                "duration": { "type": "float" },
                 "tags": {
                     "type": "nested",
                     "properties": {
+                        "id": { "type": "integer" },
+                        "title_model": { "type": "keyword" },
                         "title_en": {
                             "type": "text",
                             "analyzer": "english",
@@ -84,8 +92,91 @@ const PinMapping = `{
                         }
                     }
                 },
+                "suggest_text": { "type": "text", "analyzer": "standard" },
+                "palette": { "type": "keyword" },
+                "blurhash": { "type": "keyword", "index": false },
+                "colors": {
+                    "type": "nested",
+                    "properties": {
+                        "hex": { "type": "keyword" },
+                        "l": { "type": "float" },
+                        "a": { "type": "float" },
+                        "b": { "type": "float" }
+                    }
+                },
+                "likes": { "type": "integer" },
+                "saves": { "type": "integer" },
+                "comments": { "type": "integer" },
                 "created_at": { "type": "date" },
                 "updated_at": { "type": "date" }
             }
         }
     }`
+
+// TagMapping — индекс подсказок тегов. Edge n-gram находит теги по началу любого слова названия,
+// completion — по началу всего названия с учетом опечаток; вес подсказки равен Tag.Count
+const TagMapping = `{
+        "settings": {
+            "analysis": {
+                "char_filter": {
+                    "underscore_to_space": {
+                        "type": "mapping",
+                        "mappings": ["_ => \\u0020"]
+                    }
+                },
+                "filter": {
+                    "autocomplete_filter": {
+                        "type": "edge_ngram",
+                        "min_gram": 1,
+                        "max_gram": 20
+                    }
+                },
+                "analyzer": {
+                    "autocomplete": {
+                        "tokenizer": "standard",
+                        "char_filter": ["underscore_to_space"],
+                        "filter": ["lowercase", "autocomplete_filter"]
+                    },
+                    "autocomplete_search": {
+                        "tokenizer": "standard",
+                        "char_filter": ["underscore_to_space"],
+                        "filter": ["lowercase"]
+                    }
+                }
+            }
+        },
+        "mappings": {
+            "properties": {
+                "id": { "type": "integer" },
+                "count": { "type": "integer" },
+                "title_model": {
+                    "type": "text",
+                    "analyzer": "autocomplete",
+                    "search_analyzer": "autocomplete_search",
+                    "fields": {
+                        "keyword": { "type": "keyword" }
+                    }
+                },
+                "title_en": {
+                    "type": "text",
+                    "analyzer": "autocomplete",
+                    "search_analyzer": "autocomplete_search",
+                    "fields": {
+                        "keyword": { "type": "keyword" }
+                    }
+                },
+                "title_ru": {
+                    "type": "text",
+                    "analyzer": "autocomplete",
+                    "search_analyzer": "autocomplete_search",
+                    "fields": {
+                        "keyword": { "type": "keyword" }
+                    }
+                },
+                "suggest": {
+                    "type": "completion",
+                    "analyzer": "simple"
+                }
+            }
+        }
+    }`
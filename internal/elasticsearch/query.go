@@ -0,0 +1,288 @@
+package elasticsearch
+
+import (
+	"strings"
+
+	"pornterest/internal/searchql"
+)
+
+// CompileQuery переводит разобранный запрос в запрос Elasticsearch.
+// Текст, фразы и теги влияют на релевантность, ключевые слова (type:, user:, ai:, размеры) только фильтруют.
+// users сопоставляет никнеймы из user: с id авторов
+func CompileQuery(node searchql.Node, users map[string]int) map[string]interface{} {
+	switch n := node.(type) {
+	case searchql.And:
+		return compileAnd(n, users)
+	case searchql.Or:
+		should := make([]map[string]interface{}, len(n.Nodes))
+		for i, child := range n.Nodes {
+			should[i] = CompileQuery(child, users)
+		}
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		}
+	case searchql.Not:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []map[string]interface{}{CompileQuery(n.Node, users)},
+			},
+		}
+	case searchql.Text:
+		return textQuery(n.Value)
+	case searchql.Phrase:
+		return phraseQuery(n.Value)
+	case searchql.Tag:
+		return tagQuery(n.Name)
+	case searchql.Type:
+		return map[string]interface{}{"term": map[string]interface{}{"type": n.Value}}
+	case searchql.AI:
+		return map[string]interface{}{"term": map[string]interface{}{"ai": n.Value}}
+	case searchql.User:
+		userID, ok := users[n.Nickname]
+		if !ok {
+			return map[string]interface{}{"match_none": map[string]interface{}{}}
+		}
+		return map[string]interface{}{"term": map[string]interface{}{"user_id": userID}}
+	case searchql.Range:
+		bounds := map[string]interface{}{}
+		if n.Min != nil {
+			bounds[rangeOp("gt", n.MinExclusive)] = *n.Min
+		}
+		if n.Max != nil {
+			bounds[rangeOp("lt", n.MaxExclusive)] = *n.Max
+		}
+		return map[string]interface{}{"range": map[string]interface{}{n.Field: bounds}}
+	}
+	return map[string]interface{}{"match_all": map[string]interface{}{}}
+}
+
+// compileAnd раскладывает условия по частям bool-запроса. Подряд идущие слова ищутся одним
+// текстовым запросом, как раньше искался весь q: так сохраняется ранжирование по совпавшим словам
+func compileAnd(n searchql.And, users map[string]int) map[string]interface{} {
+	var words []string
+	var must, filter, mustNot []map[string]interface{}
+
+	for _, child := range n.Nodes {
+		switch c := child.(type) {
+		case searchql.Text:
+			words = append(words, c.Value)
+		case searchql.Not:
+			mustNot = append(mustNot, CompileQuery(c.Node, users))
+		case searchql.Type, searchql.AI, searchql.User, searchql.Range:
+			filter = append(filter, CompileQuery(c, users))
+		default:
+			must = append(must, CompileQuery(c, users))
+		}
+	}
+	if len(words) > 0 {
+		must = append([]map[string]interface{}{textQuery(strings.Join(words, " "))}, must...)
+	}
+
+	boolQuery := map[string]interface{}{}
+	if len(must) > 0 {
+		boolQuery["must"] = must
+	}
+	if len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+func rangeOp(op string, exclusive bool) string {
+	if exclusive {
+		return op
+	}
+	return op + "e"
+}
+
+// textQuery ищет слова в тегах, названии и описании с поправкой на опечатки
+func textQuery(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				nestedTags(tagTextMatch(text)),
+				{
+					"match": map[string]interface{}{
+						"title": map[string]interface{}{
+							"query":     text,
+							"fuzziness": "AUTO",
+							"boost":     3,
+						},
+					},
+				},
+				{
+					"match": map[string]interface{}{
+						"description": map[string]interface{}{
+							"query":     text,
+							"fuzziness": "AUTO",
+							"boost":     1,
+						},
+					},
+				},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// phraseQuery ищет фразу целиком в названии, описании или названии тега
+func phraseQuery(phrase string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"match_phrase": map[string]interface{}{"title": map[string]interface{}{"query": phrase, "boost": 3}}},
+				{"match_phrase": map[string]interface{}{"description": phrase}},
+				nestedTags(tagPhraseMatch(phrase)),
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// tagQuery требует тег с точным названием: title_model (black_cat) или название на любом языке без учета регистра
+func tagQuery(name string) map[string]interface{} {
+	return nestedTags(tagNameMatch(name))
+}
+
+// nestedTags оборачивает условие на поля тега: пин подходит, если подходит хотя бы один его тег
+func nestedTags(query map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path":       "tags",
+			"query":      query,
+			"score_mode": "max",
+		},
+	}
+}
+
+// tagTextMatch ищет слова в названиях тега с поправкой на опечатки
+func tagTextMatch(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{
+					"match": map[string]interface{}{
+						"tags.title_ru": map[string]interface{}{
+							"query":     text,
+							"fuzziness": "AUTO",
+							"boost":     3,
+						},
+					},
+				},
+				{
+					"match": map[string]interface{}{
+						"tags.title_en": map[string]interface{}{
+							"query":     text,
+							"fuzziness": "AUTO",
+							"boost":     2,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// tagPhraseMatch ищет фразу целиком в названиях тега
+func tagPhraseMatch(phrase string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"match_phrase": map[string]interface{}{"tags.title_ru": map[string]interface{}{"query": phrase, "boost": 3}}},
+				{"match_phrase": map[string]interface{}{"tags.title_en": map[string]interface{}{"query": phrase, "boost": 2}}},
+			},
+		},
+	}
+}
+
+// tagNameMatch сравнивает название тега целиком без учета регистра
+func tagNameMatch(name string) map[string]interface{} {
+	term := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"term": map[string]interface{}{
+				field: map[string]interface{}{"value": name, "case_insensitive": true},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				term("tags.title_model"),
+				term("tags.title_en.keyword"),
+				term("tags.title_ru.keyword"),
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// matchedTagsInnerHits — имя inner_hits, в которых возвращаются совпавшие теги пина
+const matchedTagsInnerHits = "matched_tags"
+
+// maxMatchedTags — сколько совпавших тегов возвращается для одного пина
+const maxMatchedTags = 10
+
+// matchedTagsQuery возвращает через inner_hits теги пина, совпавшие со словами, фразами и tag: запроса.
+// Условие не влияет ни на отбор, ни на релевантность. nil, если совпадать с тегами нечему
+func matchedTagsQuery(node searchql.Node) map[string]interface{} {
+	clauses := tagMatchClauses(node)
+	if len(clauses) == 0 {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path": "tags",
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"should":               clauses,
+					"minimum_should_match": 1,
+				},
+			},
+			"score_mode": "none",
+			"inner_hits": map[string]interface{}{
+				"name": matchedTagsInnerHits,
+				"size": maxMatchedTags,
+				"highlight": map[string]interface{}{
+					"encoder": "html",
+					"fields": map[string]interface{}{
+						"tags.title_en": map[string]interface{}{"number_of_fragments": 0},
+						"tags.title_ru": map[string]interface{}{"number_of_fragments": 0},
+					},
+				},
+			},
+		},
+	}
+}
+
+// tagMatchClauses собирает условия на теги из положительной части запроса: исключенное минусом не подсвечивается
+func tagMatchClauses(node searchql.Node) []map[string]interface{} {
+	switch n := node.(type) {
+	case searchql.And:
+		var clauses []map[string]interface{}
+		for _, child := range n.Nodes {
+			clauses = append(clauses, tagMatchClauses(child)...)
+		}
+		return clauses
+	case searchql.Or:
+		var clauses []map[string]interface{}
+		for _, child := range n.Nodes {
+			clauses = append(clauses, tagMatchClauses(child)...)
+		}
+		return clauses
+	case searchql.Text:
+		return []map[string]interface{}{tagTextMatch(n.Value)}
+	case searchql.Phrase:
+		return []map[string]interface{}{tagPhraseMatch(n.Value)}
+	case searchql.Tag:
+		return []map[string]interface{}{tagNameMatch(n.Name)}
+	}
+	return nil
+}
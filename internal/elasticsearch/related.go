@@ -0,0 +1,87 @@
+package elasticsearch
+
+import (
+	"context"
+	"strconv"
+
+	"pornterest/internal/searchql"
+)
+
+// relatedTagBoost — вес одного общего тега относительно текстовой похожести
+const relatedTagBoost = 2
+
+// RelatedPinsRequest — параметры запроса страницы похожих пинов
+type RelatedPinsRequest struct {
+	PinID int
+	// TagIDs — теги исходного пина: чем больше их у кандидата, тем он выше
+	TagIDs []int
+	// ExcludeUserIDs — авторы, пины которых не показываются
+	ExcludeUserIDs []int
+	Size           int
+	// After — позиция из предыдущей страницы; nil для первой страницы
+	After *SearchAfter
+}
+
+// RelatedPinPage возвращает страницу пинов, похожих на исходный: more_like_this по названию,
+// описанию и названиям тегов плюс число общих тегов. Сам пин в выдачу не попадает.
+// Похожие смотрят на каждом открытом пине, а дальше первой страницы листают редко,
+// поэтому снимок индекса не открывается: страницы читаются по одному search_after
+func (es *ESClient) RelatedPinPage(ctx context.Context, req RelatedPinsRequest) (*PinSearchPage, error) {
+	should := []map[string]interface{}{
+		{
+			"more_like_this": map[string]interface{}{
+				"fields": []string{"title", "description", "suggest_text"},
+				"like": []map[string]interface{}{
+					{"_index": PinsAlias, "_id": strconv.Itoa(req.PinID)},
+				},
+				// Названия короткие: слово, встретившееся один раз, уже характеризует пин
+				"min_term_freq":        1,
+				"min_doc_freq":         2,
+				"max_query_terms":      25,
+				"minimum_should_match": "30%",
+			},
+		},
+	}
+	if len(req.TagIDs) > 0 {
+		// Каждый совпавший вложенный тег дает 1, score_mode sum превращает это в число общих тегов
+		should = append(should, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path": "tags",
+				"query": map[string]interface{}{
+					"terms": map[string]interface{}{"tags.id": req.TagIDs},
+				},
+				"score_mode": "sum",
+				"boost":      relatedTagBoost,
+			},
+		})
+	}
+
+	mustNot := []map[string]interface{}{
+		{"ids": map[string]interface{}{"values": []string{strconv.Itoa(req.PinID)}}},
+	}
+	if len(req.ExcludeUserIDs) > 0 {
+		mustNot = append(mustNot, map[string]interface{}{
+			"terms": map[string]interface{}{"user_id": req.ExcludeUserIDs},
+		})
+	}
+
+	body := map[string]interface{}{
+		"_source": []string{"id"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+				"must_not":             mustNot,
+			},
+		},
+		"sort":             pinSearchSort(searchql.SortRelevance, true),
+		"size":             req.Size + 1, // лишний хит показывает, есть ли следующая страница
+		"track_total_hits": true,
+	}
+
+	if req.After != nil {
+		body["search_after"] = req.After.Sort
+	}
+	page, _, err := es.searchPage(ctx, body, req.Size)
+	return page, err
+}
@@ -0,0 +1,539 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"pornterest/internal/searchql"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// SearchKeepAlive — сколько Elasticsearch хранит снимок индекса (point-in-time) между запросами страниц
+const SearchKeepAlive = "5m"
+
+// ErrSearchExpired возвращается, когда снимок индекса из курсора истек или закрыт — поиск нужно начать заново
+var ErrSearchExpired = errors.New("search cursor expired")
+
+// SearchAfter — позиция в выдаче поиска: снимок индекса и значения сортировки последнего хита страницы.
+// Значения сортировки хранятся как есть, чтобы не терять точность чисел. Выдачи без снимка оставляют PIT пустым
+type SearchAfter struct {
+	PIT  string            `json:"pit,omitempty"`
+	Sort []json.RawMessage `json:"sort"`
+	// Origin — момент, от которого считается возраст в trending. Фиксируется на первой странице,
+	// иначе оценки между страницами разъедутся и search_after пропустит хиты
+	Origin *time.Time `json:"origin,omitempty"`
+}
+
+// PinSearchRequest — параметры запроса страницы поиска пинов
+type PinSearchRequest struct {
+	// Query — разобранный запрос; nil для поиска только по фильтрам
+	Query *searchql.Query
+	// Users — id авторов из user: по никнеймам. Неизвестный автор ничего не находит
+	Users   map[string]int
+	Filters PinSearchFilters
+	// Sort — порядок выдачи из searchql.SortValues; пустой — по релевантности, без запроса — сначала новые
+	Sort string
+	Size int
+	// After — позиция из предыдущей страницы; nil для первой страницы
+	After *SearchAfter
+	// Facets — посчитать агрегации для боковой панели
+	Facets bool
+}
+
+// FacetTopTags — сколько самых частых тегов выдачи возвращается в фасетах
+const FacetTopTags = 20
+
+// PinFacets — агрегации по всей выдаче с учетом текущих фильтров
+type PinFacets struct {
+	// Types — количество пинов по типу медиа
+	Types map[string]int
+	AI    int
+	NonAI int
+	// Tags — самые частые теги выдачи по убыванию количества
+	Tags []TagBucket
+}
+
+// TagBucket — тег и количество пинов выдачи с ним
+type TagBucket struct {
+	TagID int
+	Count int
+}
+
+// PinHighlight — совпадения запроса в найденном пине
+type PinHighlight struct {
+	// Fields — фрагменты полей с совпадениями в <em>: title, description, original_file_name,
+	// tags.title_en, tags.title_ru. Текст экранирован как HTML
+	Fields map[string][]string
+	// Tags — теги пина, совпавшие со словами, фразами или tag: запроса
+	Tags []TagDocument
+}
+
+// PinSearchPage — страница результатов поиска
+type PinSearchPage struct {
+	// IDs — id найденных пинов в порядке выдачи
+	IDs []int
+	// Highlights — почему пин совпал, по id пина. Пины без подсветки в карту не попадают
+	Highlights map[int]PinHighlight
+	// Total — точное число документов, подходящих под запрос
+	Total int
+	// Next — позиция следующей страницы, nil на последней
+	Next *SearchAfter
+	// Facets заполняется, только если они запрошены
+	Facets *PinFacets
+}
+
+// SearchPinPage возвращает одну страницу поиска. Страницы читаются из одного снимка индекса
+// через search_after, поэтому новые и удаленные пины не сдвигают уже начатую выдачу
+func (es *ESClient) SearchPinPage(ctx context.Context, req PinSearchRequest) (*PinSearchPage, error) {
+	origin := time.Now().UTC().Truncate(time.Second)
+	if req.After != nil && req.After.Origin != nil {
+		origin = *req.After.Origin
+	}
+
+	query := pinSearchQuery(req.Query, req.Users, req.Filters)
+	if req.Sort == searchql.SortTrending {
+		query = trendingQuery(query, origin)
+	}
+
+	body := map[string]interface{}{
+		"_source":          []string{"id"},
+		"query":            query,
+		"sort":             pinSearchSort(req.Sort, req.Query != nil && req.Query.Root != nil),
+		"size":             req.Size + 1, // лишний хит показывает, есть ли следующая страница
+		"track_total_hits": true,
+	}
+	if req.Facets {
+		body["aggs"] = pinFacetAggs()
+	}
+	if req.Query != nil && req.Query.Root != nil {
+		body["highlight"] = pinHighlight()
+	}
+
+	page, err := es.pitSearchPage(ctx, body, req.Size, req.After)
+	if err != nil {
+		return nil, err
+	}
+	if page.Next != nil && req.Sort == searchql.SortTrending {
+		page.Next.Origin = &origin
+	}
+	return page, nil
+}
+
+// pitSearchPage читает страницу из снимка индекса пинов: для первой страницы снимок открывается,
+// на последней закрывается. body — запрос без pit и search_after
+func (es *ESClient) pitSearchPage(ctx context.Context, body map[string]interface{}, size int, after *SearchAfter) (*PinSearchPage, error) {
+	pit := ""
+	if after != nil {
+		pit = after.PIT
+		body["search_after"] = after.Sort
+	} else {
+		var err error
+		if pit, err = es.openPointInTime(ctx, PinsAlias); err != nil {
+			return nil, err
+		}
+	}
+	body["pit"] = map[string]interface{}{
+		"id":         pit,
+		"keep_alive": SearchKeepAlive,
+	}
+
+	page, pit, err := es.searchPage(ctx, body, size)
+	if err != nil {
+		if after == nil {
+			es.closePointInTime(pit)
+		}
+		return nil, err
+	}
+
+	if page.Next != nil {
+		page.Next.PIT = pit
+	} else {
+		// Выдача дочитана — снимок больше не нужен, не ждем истечения keep_alive
+		es.closePointInTime(pit)
+	}
+	return page, nil
+}
+
+// searchPage выполняет поиск и возвращает страницу и актуальный id снимка. Если в body нет pit,
+// поиск идет по текущему состоянию индекса пинов, а id снимка пустой
+func (es *ESClient) searchPage(ctx context.Context, body map[string]interface{}, size int) (*PinSearchPage, string, error) {
+	pit := ""
+	if p, ok := body["pit"].(map[string]interface{}); ok {
+		pit = p["id"].(string)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, pit, fmt.Errorf("error encoding query: %v", err)
+	}
+
+	opts := []func(*esapi.SearchRequest){
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithBody(&buf),
+	}
+	if pit == "" {
+		// Запрос со снимком не должен указывать индекс, без снимка — обязан
+		opts = append(opts, es.client.Search.WithIndex(PinsAlias))
+	}
+	res, err := es.client.Search(opts...)
+	if err != nil {
+		return nil, pit, fmt.Errorf("error searching: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 && pit != "" {
+		return nil, pit, ErrSearchExpired
+	}
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, pit, fmt.Errorf("search error: %s", string(body))
+	}
+
+	var result struct {
+		PitID string `json:"pit_id"`
+		Hits  struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source struct {
+					ID int `json:"id"`
+				} `json:"_source"`
+				Sort      []json.RawMessage   `json:"sort"`
+				Highlight map[string][]string `json:"highlight"`
+				InnerHits map[string]struct {
+					Hits struct {
+						Hits []struct {
+							Source    TagDocument         `json:"_source"`
+							Highlight map[string][]string `json:"highlight"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"inner_hits"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations *facetAggsResult `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, pit, fmt.Errorf("error parsing response: %v", err)
+	}
+	if result.PitID != "" {
+		pit = result.PitID
+	}
+
+	hits := result.Hits.Hits
+	page := &PinSearchPage{Total: result.Hits.Total.Value}
+	if len(hits) > size {
+		hits = hits[:size]
+		page.Next = &SearchAfter{Sort: hits[size-1].Sort}
+	}
+
+	page.IDs = make([]int, len(hits))
+	page.Highlights = make(map[int]PinHighlight)
+	for i, hit := range hits {
+		page.IDs[i] = hit.Source.ID
+
+		highlight := PinHighlight{Fields: hit.Highlight}
+		for _, tagHit := range hit.InnerHits[matchedTagsInnerHits].Hits.Hits {
+			highlight.Tags = append(highlight.Tags, tagHit.Source)
+			for field, fragments := range tagHit.Highlight {
+				if highlight.Fields == nil {
+					highlight.Fields = make(map[string][]string)
+				}
+				highlight.Fields[field] = append(highlight.Fields[field], fragments...)
+			}
+		}
+		if len(highlight.Fields) > 0 || len(highlight.Tags) > 0 {
+			page.Highlights[hit.Source.ID] = highlight
+		}
+	}
+	if result.Aggregations != nil {
+		page.Facets = result.Aggregations.facets()
+	}
+	return page, pit, nil
+}
+
+// pinHighlight описывает подсветку совпадений в полях пина. Подсвеченные теги приходят
+// отдельно, из inner_hits matchedTagsQuery: вложенные поля на верхнем уровне не подсвечиваются
+func pinHighlight() map[string]interface{} {
+	return map[string]interface{}{
+		"encoder": "html",
+		// Имя файла в текстовом запросе не участвует, но совпадение в нем тоже объясняет выдачу
+		"require_field_match": false,
+		"fields": map[string]interface{}{
+			"title":              map[string]interface{}{"number_of_fragments": 0},
+			"description":        map[string]interface{}{"fragment_size": 150, "number_of_fragments": 3},
+			"original_file_name": map[string]interface{}{"number_of_fragments": 0},
+		},
+	}
+}
+
+// pinFacetAggs описывает агрегации фасетов
+func pinFacetAggs() map[string]interface{} {
+	return map[string]interface{}{
+		"types": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "type", "size": 10},
+		},
+		"ai": map[string]interface{}{
+			"filters": map[string]interface{}{
+				"filters": map[string]interface{}{
+					"ai":     map[string]interface{}{"term": map[string]interface{}{"ai": true}},
+					"non_ai": map[string]interface{}{"bool": map[string]interface{}{"must_not": map[string]interface{}{"term": map[string]interface{}{"ai": true}}}},
+				},
+			},
+		},
+		"tags": map[string]interface{}{
+			"nested": map[string]interface{}{"path": "tags"},
+			"aggs": map[string]interface{}{
+				// Тег встречается у пина один раз, поэтому число вложенных документов равно числу пинов
+				"top": map[string]interface{}{
+					"terms": map[string]interface{}{"field": "tags.id", "size": FacetTopTags},
+				},
+			},
+		},
+	}
+}
+
+type termsBuckets struct {
+	Buckets []struct {
+		Key      json.RawMessage `json:"key"`
+		DocCount int             `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type facetAggsResult struct {
+	Types termsBuckets `json:"types"`
+	AI    struct {
+		Buckets map[string]struct {
+			DocCount int `json:"doc_count"`
+		} `json:"buckets"`
+	} `json:"ai"`
+	Tags struct {
+		Top termsBuckets `json:"top"`
+	} `json:"tags"`
+}
+
+func (r *facetAggsResult) facets() *PinFacets {
+	facets := &PinFacets{
+		Types: make(map[string]int, len(r.Types.Buckets)),
+		AI:    r.AI.Buckets["ai"].DocCount,
+		NonAI: r.AI.Buckets["non_ai"].DocCount,
+		Tags:  make([]TagBucket, 0, len(r.Tags.Top.Buckets)),
+	}
+	for _, b := range r.Types.Buckets {
+		var typ string
+		if json.Unmarshal(b.Key, &typ) == nil {
+			facets.Types[typ] = b.DocCount
+		}
+	}
+	for _, b := range r.Tags.Top.Buckets {
+		var id int
+		if json.Unmarshal(b.Key, &id) == nil {
+			facets.Tags = append(facets.Tags, TagBucket{TagID: id, Count: b.DocCount})
+		}
+	}
+	return facets
+}
+
+// pinSearchQuery объединяет разобранный запрос и фильтры. Без запроса — выборка только по фильтрам
+func pinSearchQuery(query *searchql.Query, users map[string]int, filters PinSearchFilters) map[string]interface{} {
+	boolQuery := map[string]interface{}{}
+	if query != nil && query.Root != nil {
+		boolQuery["must"] = []map[string]interface{}{CompileQuery(query.Root, users)}
+		if matched := matchedTagsQuery(query.Root); matched != nil {
+			boolQuery["should"] = []map[string]interface{}{matched}
+		}
+	}
+	if filter := pinFilterClauses(filters); len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+// pinFilterClauses переводит фильтры в условия filter-контекста: они не влияют на релевантность и кэшируются
+func pinFilterClauses(filters PinSearchFilters) []map[string]interface{} {
+	var filter []map[string]interface{}
+	if filters.Color != nil {
+		filter = append(filter, colorFilter(*filters.Color, ColorMatchDistance))
+	}
+	if len(filters.Types) > 0 {
+		filter = append(filter, map[string]interface{}{"terms": map[string]interface{}{"type": filters.Types}})
+	}
+	if filters.AI != nil {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"ai": *filters.AI}})
+	}
+	if filters.UserID != nil {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"user_id": *filters.UserID}})
+	}
+	if filters.Orientation != "" {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"orientation": filters.Orientation}})
+	}
+
+	if r := rangeBounds(filters.CreatedFrom, filters.CreatedTo, "gte", "lt"); r != nil {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"created_at": r}})
+	}
+	if r := rangeBounds(filters.MinWidth, filters.MaxWidth, "gte", "lte"); r != nil {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"width": r}})
+	}
+	if r := rangeBounds(filters.MinHeight, filters.MaxHeight, "gte", "lte"); r != nil {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"height": r}})
+	}
+	if r := rangeBounds(filters.MinDuration, filters.MaxDuration, "gte", "lte"); r != nil {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"duration": r}})
+	}
+
+	return filter
+}
+
+// rangeBounds собирает тело range-запроса из необязательных границ, nil если обе не заданы
+func rangeBounds[T any](lower, upper *T, lowerOp, upperOp string) map[string]interface{} {
+	if lower == nil && upper == nil {
+		return nil
+	}
+	bounds := map[string]interface{}{}
+	if lower != nil {
+		bounds[lowerOp] = *lower
+	}
+	if upper != nil {
+		bounds[upperOp] = *upper
+	}
+	return bounds
+}
+
+// pinSearchSort возвращает порядок выдачи. created_at и id в конце делают порядок полным,
+// без этого search_after может пропускать или повторять хиты с одинаковыми ключами
+func pinSearchSort(sort string, hasQuery bool) []map[string]interface{} {
+	tail := []map[string]interface{}{
+		{"created_at": "desc"},
+		{"id": "desc"},
+	}
+	byField := func(field string) []map[string]interface{} {
+		return append([]map[string]interface{}{{field: "desc"}}, tail...)
+	}
+
+	switch sort {
+	case searchql.SortNew:
+		return tail
+	case searchql.SortLikes:
+		return byField("likes")
+	case searchql.SortSaves:
+		return byField("saves")
+	case searchql.SortTrending:
+		return byField("_score")
+	}
+	if !hasQuery {
+		// Без запроса релевантность не определена — показываем сначала новые
+		return tail
+	}
+	return byField("_score")
+}
+
+// Параметры trending: вес каждого вида вовлеченности и скорость затухания по возрасту
+const (
+	trendingLikeWeight    = 1.0
+	trendingSaveWeight    = 2.0
+	trendingCommentWeight = 1.5
+	// trendingBaseScore — оценка пина без вовлеченности, чтобы свежие пины не уходили в самый конец
+	trendingBaseScore = 0.1
+	// За trendingScale после trendingOffset оценка падает вдвое
+	trendingScale  = "3d"
+	trendingOffset = "6h"
+)
+
+// trendingQuery заменяет релевантность оценкой вовлеченности: логарифм лайков, сохранений и комментариев,
+// умноженный на гауссово затухание по возрасту от origin
+func trendingQuery(query map[string]interface{}, origin time.Time) map[string]interface{} {
+	engagement := func(field string, weight float64) map[string]interface{} {
+		return map[string]interface{}{
+			"field_value_factor": map[string]interface{}{
+				"field":    field,
+				"modifier": "log1p",
+				"missing":  0,
+			},
+			"weight": weight,
+		}
+	}
+
+	return map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query": map[string]interface{}{
+				"function_score": map[string]interface{}{
+					"query": query,
+					"functions": []map[string]interface{}{
+						engagement("likes", trendingLikeWeight),
+						engagement("saves", trendingSaveWeight),
+						engagement("comments", trendingCommentWeight),
+						{"weight": trendingBaseScore},
+					},
+					"score_mode": "sum",
+					"boost_mode": "replace",
+				},
+			},
+			"functions": []map[string]interface{}{
+				{
+					"gauss": map[string]interface{}{
+						"created_at": map[string]interface{}{
+							"origin": origin.Format(time.RFC3339),
+							"scale":  trendingScale,
+							"offset": trendingOffset,
+							"decay":  0.5,
+						},
+					},
+				},
+			},
+			"boost_mode": "multiply",
+		},
+	}
+}
+
+// openPointInTime открывает снимок индекса для постраничного чтения
+func (es *ESClient) openPointInTime(ctx context.Context, index string) (string, error) {
+	res, err := es.client.OpenPointInTime(
+		[]string{index},
+		SearchKeepAlive,
+		es.client.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error opening point in time: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", fmt.Errorf("error opening point in time: %s", res.String())
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error parsing point in time response: %v", err)
+	}
+	return result.ID, nil
+}
+
+// closePointInTime освобождает снимок индекса. Ошибка только логируется: снимок все равно истечет
+func (es *ESClient) closePointInTime(pit string) {
+	if pit == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{"id": pit})
+	res, err := es.client.ClosePointInTime(
+		es.client.ClosePointInTime.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		log.Printf("Failed to close point in time: %v", err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		log.Printf("Failed to close point in time: %s", res.String())
+	}
+}
@@ -0,0 +1,144 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxPhraseSuggestions — сколько вариантов "возможно, вы искали" возвращается
+const maxPhraseSuggestions = 3
+
+// PhraseSuggestion — исправленный вариант текста запроса
+type PhraseSuggestion struct {
+	Text string `json:"text"`
+	// Highlighted — тот же текст с исправленными словами в <em>
+	Highlighted string `json:"highlighted"`
+}
+
+// SuggestPhrases предлагает исправления текста по словарю названий пинов и тегов.
+// Предлагаются только варианты, по которым что-то находится
+func (es *ESClient) SuggestPhrases(ctx context.Context, text string) ([]PhraseSuggestion, error) {
+	body := map[string]interface{}{
+		"size": 0,
+		"suggest": map[string]interface{}{
+			"text": text,
+			"did_you_mean": map[string]interface{}{
+				"phrase": map[string]interface{}{
+					"field":      "suggest_text",
+					"size":       maxPhraseSuggestions,
+					"gram_size":  1,
+					"max_errors": 2,
+					"direct_generator": []map[string]interface{}{
+						{
+							"field":           "suggest_text",
+							"suggest_mode":    "always",
+							"min_word_length": 3,
+						},
+					},
+					"collate": map[string]interface{}{
+						"query": map[string]interface{}{
+							"source": map[string]interface{}{
+								"match": map[string]interface{}{
+									"suggest_text": map[string]interface{}{
+										"query":    "{{suggestion}}",
+										"operator": "and",
+									},
+								},
+							},
+						},
+						"prune": false,
+					},
+					"highlight": map[string]interface{}{
+						"pre_tag":  "<em>",
+						"post_tag": "</em>",
+					},
+				},
+			},
+		},
+	}
+
+	var result struct {
+		Suggest struct {
+			DidYouMean []struct {
+				Options []PhraseSuggestion `json:"options"`
+			} `json:"did_you_mean"`
+		} `json:"suggest"`
+	}
+	if err := es.searchPins(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]PhraseSuggestion, 0, maxPhraseSuggestions)
+	for _, entry := range result.Suggest.DidYouMean {
+		suggestions = append(suggestions, entry.Options...)
+	}
+	return suggestions, nil
+}
+
+// WordDocFrequencies возвращает, в скольких пинах встречается каждое слово, с той же
+// поправкой на опечатки, что и при поиске. Нужна, чтобы ослаблять запрос, убирая самые редкие слова
+func (es *ESClient) WordDocFrequencies(ctx context.Context, words []string) (map[string]int, error) {
+	filters := make(map[string]interface{}, len(words))
+	for i, word := range words {
+		filters[fmt.Sprintf("w%d", i)] = textQuery(word)
+	}
+
+	body := map[string]interface{}{
+		"size": 0,
+		"aggs": map[string]interface{}{
+			"words": map[string]interface{}{
+				"filters": map[string]interface{}{"filters": filters},
+			},
+		},
+	}
+
+	var result struct {
+		Aggregations struct {
+			Words struct {
+				Buckets map[string]struct {
+					DocCount int `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"words"`
+		} `json:"aggregations"`
+	}
+	if err := es.searchPins(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	freq := make(map[string]int, len(words))
+	for i, word := range words {
+		freq[word] = result.Aggregations.Words.Buckets[fmt.Sprintf("w%d", i)].DocCount
+	}
+	return freq, nil
+}
+
+// searchPins выполняет вспомогательный запрос к индексу пинов и разбирает ответ в result
+func (es *ESClient) searchPins(ctx context.Context, body map[string]interface{}, result interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return fmt.Errorf("error encoding query: %v", err)
+	}
+
+	res, err := es.client.Search(
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithIndex(PinsAlias),
+		es.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return fmt.Errorf("error searching: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("search error: %s", string(body))
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+	return nil
+}
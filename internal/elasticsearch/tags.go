@@ -0,0 +1,208 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pornterest/internal/models"
+)
+
+// TagsIndex — индекс подсказок тегов
+const TagsIndex = "tags"
+
+// TagSuggestDocument — тег в индексе подсказок
+type TagSuggestDocument struct {
+	ID         int             `json:"id"`
+	TitleModel string          `json:"title_model"`
+	TitleEN    string          `json:"title_en"`
+	TitleRU    string          `json:"title_ru"`
+	Count      int             `json:"count"`
+	Suggest    *CompletionItem `json:"suggest,omitempty"`
+}
+
+// CompletionItem — варианты ввода completion-подсказки и ее вес
+type CompletionItem struct {
+	Input  []string `json:"input"`
+	Weight int      `json:"weight"`
+}
+
+// NewTagSuggestDocument собирает документ подсказки: тег предлагается по любому из названий,
+// популярные теги — выше
+func NewTagSuggestDocument(tag *models.Tag) TagSuggestDocument {
+	var inputs []string
+	for _, title := range []string{tag.TitleEN, tag.TitleRU, strings.ReplaceAll(tag.TitleModel, "_", " ")} {
+		title = strings.TrimSpace(title)
+		if title != "" && !containsFold(inputs, title) {
+			inputs = append(inputs, title)
+		}
+	}
+
+	doc := TagSuggestDocument{
+		ID:         tag.ID,
+		TitleModel: tag.TitleModel,
+		TitleEN:    tag.TitleEN,
+		TitleRU:    tag.TitleRU,
+		Count:      tag.Count,
+	}
+	if len(inputs) > 0 {
+		doc.Suggest = &CompletionItem{Input: inputs, Weight: max(tag.Count, 0)}
+	}
+	return doc
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureTagIndex создает индекс подсказок тегов или добавляет в него новые поля TagMapping
+func (es *ESClient) EnsureTagIndex(ctx context.Context) error {
+	return es.createIndex(ctx, TagsIndex, TagMapping)
+}
+
+// BulkIndexTags индексирует теги одним запросом Bulk API
+func (es *ESClient) BulkIndexTags(ctx context.Context, docs []TagSuggestDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		meta := map[string]interface{}{
+			"index": map[string]interface{}{
+				"_index": TagsIndex,
+				"_id":    strconv.Itoa(doc.ID),
+			},
+		}
+		if err := enc.Encode(meta); err != nil {
+			return fmt.Errorf("error encoding bulk action: %v", err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("error encoding tag %d: %v", doc.ID, err)
+		}
+	}
+
+	return es.sendBulk(ctx, &buf, len(docs), false)
+}
+
+// SuggestTags возвращает до limit тегов для строки автодополнения. variants — та же строка
+// в разных раскладках: подсказки по всем вариантам объединяются. Сначала идут совпадения
+// по началу названия (с поправкой на опечатки), затем по началу любого слова
+func (es *ESClient) SuggestTags(ctx context.Context, variants []string, limit int) ([]TagSuggestDocument, error) {
+	source := []string{"id", "title_model", "title_en", "title_ru", "count"}
+
+	suggest := map[string]interface{}{}
+	should := make([]map[string]interface{}, 0, len(variants))
+	for i, v := range variants {
+		suggest[fmt.Sprintf("v%d", i)] = map[string]interface{}{
+			"prefix": v,
+			"completion": map[string]interface{}{
+				"field":           "suggest",
+				"size":            limit,
+				"skip_duplicates": true,
+				"fuzzy":           map[string]interface{}{"fuzziness": "AUTO"},
+			},
+		}
+		should = append(should, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    v,
+				"fields":   []string{"title_en", "title_ru", "title_model"},
+				"operator": "and",
+			},
+		})
+	}
+
+	body := map[string]interface{}{
+		"_source": source,
+		"size":    limit,
+		"query": map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"should":               should,
+						"minimum_should_match": 1,
+					},
+				},
+				"field_value_factor": map[string]interface{}{
+					"field":    "count",
+					"modifier": "log2p",
+					"missing":  0,
+				},
+				"boost_mode": "multiply",
+			},
+		},
+		"suggest": suggest,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("error encoding query: %v", err)
+	}
+
+	res, err := es.client.Search(
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithIndex(TagsIndex),
+		es.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error searching tags: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("tag suggest error: %s", string(body))
+	}
+
+	type hit struct {
+		Score  float64            `json:"_score"`
+		Source TagSuggestDocument `json:"_source"`
+	}
+	var result struct {
+		Hits struct {
+			Hits []hit `json:"hits"`
+		} `json:"hits"`
+		Suggest map[string][]struct {
+			Options []hit `json:"options"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	var completions []hit
+	for _, entries := range result.Suggest {
+		for _, entry := range entries {
+			completions = append(completions, entry.Options...)
+		}
+	}
+	// Оценка completion — вес тега, пониженный за исправленные опечатки
+	sort.SliceStable(completions, func(i, j int) bool {
+		return completions[i].Score > completions[j].Score
+	})
+
+	tags := make([]TagSuggestDocument, 0, limit)
+	seen := make(map[int]bool)
+	for _, h := range append(completions, result.Hits.Hits...) {
+		if len(tags) == limit {
+			break
+		}
+		if seen[h.Source.ID] {
+			continue
+		}
+		seen[h.Source.ID] = true
+		tags = append(tags, h.Source)
+	}
+	return tags, nil
+}
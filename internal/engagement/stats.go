@@ -0,0 +1,148 @@
+// Package engagement считает лайки, сохранения и комментарии пинов и переносит их в поисковый индекс
+package engagement
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pornterest/internal/elasticsearch"
+
+	"gorm.io/gorm"
+)
+
+// syncBatchSize — сколько пинов синхронизируется за один проход
+const syncBatchSize = 500
+
+// LoadStats считает счетчики для пинов. Пины без лайков, сохранений и комментариев получают нулевые счетчики
+func LoadStats(db *gorm.DB, pinIDs []int) (map[int]elasticsearch.PinStats, error) {
+	stats := make(map[int]elasticsearch.PinStats, len(pinIDs))
+	if len(pinIDs) == 0 {
+		return stats, nil
+	}
+	for _, id := range pinIDs {
+		stats[id] = elasticsearch.PinStats{}
+	}
+
+	var actions []struct {
+		PinID  int
+		Action string
+		Count  int
+	}
+	if err := db.Table("user_actions").
+		Select("pin_id, action, COUNT(*) AS count").
+		Where("pin_id IN ? AND action IN ?", pinIDs, []string{"like", "save"}).
+		Group("pin_id, action").
+		Scan(&actions).Error; err != nil {
+		return nil, fmt.Errorf("failed to count pin actions: %w", err)
+	}
+	for _, row := range actions {
+		s := stats[row.PinID]
+		if row.Action == "like" {
+			s.Likes = row.Count
+		} else {
+			s.Saves = row.Count
+		}
+		stats[row.PinID] = s
+	}
+
+	var comments []struct {
+		PinID int
+		Count int
+	}
+	if err := db.Table("comments").
+		Select("pin_id, COUNT(*) AS count").
+		Where("pin_id IN ?", pinIDs).
+		Group("pin_id").
+		Scan(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to count pin comments: %w", err)
+	}
+	for _, row := range comments {
+		s := stats[row.PinID]
+		s.Comments = row.Count
+		stats[row.PinID] = s
+	}
+
+	return stats, nil
+}
+
+// Syncer периодически переносит изменившиеся счетчики в индекс. Какие пины изменились, отмечают
+// триггеры на user_actions и comments в pins.stats_changed_at
+type Syncer struct {
+	db     *gorm.DB
+	es     *elasticsearch.ESClient
+	logger *slog.Logger
+}
+
+func NewSyncer(db *gorm.DB, es *elasticsearch.ESClient, logger *slog.Logger) *Syncer {
+	return &Syncer{
+		db:     db,
+		es:     es,
+		logger: logger,
+	}
+}
+
+// Start запускает фоновую синхронизацию с заданным интервалом
+func (s *Syncer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				synced, err := s.SyncBatch(context.Background())
+				if err != nil {
+					s.logger.Error("failed to sync pin stats", "error", err)
+					break
+				}
+				if synced < syncBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// SyncBatch синхронизирует очередную порцию изменившихся пинов и возвращает их количество
+func (s *Syncer) SyncBatch(ctx context.Context) (int, error) {
+	var changed []struct {
+		ID             int
+		StatsChangedAt time.Time
+	}
+	if err := s.db.Table("pins").
+		Select("id, stats_changed_at").
+		Where("stats_changed_at IS NOT NULL AND (stats_synced_at IS NULL OR stats_synced_at < stats_changed_at)").
+		Order("stats_changed_at ASC").
+		Limit(syncBatchSize).
+		Scan(&changed).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch changed pins: %w", err)
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, len(changed))
+	for i, pin := range changed {
+		ids[i] = pin.ID
+	}
+	stats, err := LoadStats(s.db, ids)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.es.UpdatePinStats(ctx, stats); err != nil {
+		return 0, err
+	}
+
+	// Отмечаем синхронизированным момент изменения, который видели: если счетчики поменялись
+	// за время синхронизации, stats_changed_at станет позже и пин попадет в следующий проход
+	for _, pin := range changed {
+		if err := s.db.Table("pins").
+			Where("id = ?", pin.ID).
+			Update("stats_synced_at", pin.StatsChangedAt).Error; err != nil {
+			return 0, fmt.Errorf("failed to mark pin %d stats as synced: %w", pin.ID, err)
+		}
+	}
+
+	return len(changed), nil
+}
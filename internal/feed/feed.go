@@ -0,0 +1,337 @@
+// Package feed собирает домашнюю ленту пользователя из пинов авторов и тегов, на которые он подписан.
+// Лента строится при чтении (fan-out-on-read) и кэшируется в памяти процесса на timelineTTL.
+// Каждая реплика держит свой кэш, а сброс идет через users.feed_version, так что изменения
+// подписок видны на всех репликах со следующего запроса
+package feed
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// TimelineSize — сколько пинов хранится в ленте одного пользователя. Обрезанная лента помечается
+	// Truncated: подписки дальше читаются из базы через FollowingAfter, популярные на этом кончаются
+	TimelineSize = 500
+	// timelineTTL — сколько живет собранная лента: новые пины подписок появляются с этой задержкой
+	timelineTTL = time.Minute
+	// maxCachedTimelines — больше лент в памяти не держим, лишние вытесняются
+	maxCachedTimelines = 10000
+	// popularWindow — за какой период считаются лайки и сохранения популярных пинов
+	popularWindow = 7 * 24 * time.Hour
+)
+
+// Источники ленты
+const (
+	// SourceFollowing — пины авторов и тегов из подписок, от новых к старым
+	SourceFollowing = "following"
+	// SourcePopular — популярные пины для тех, у кого подписки пока ничего не дали
+	SourcePopular = "popular"
+)
+
+// Entry — пин ленты и ключ его сортировки
+type Entry struct {
+	PinID     int
+	UserID    int
+	CreatedAt time.Time
+	// Score — лайки и сохранения за popularWindow, только для SourcePopular
+	Score int
+}
+
+// Timeline — собранная лента. Following упорядочена по (CreatedAt, PinID), Popular — по (Score, PinID), по убыванию
+type Timeline struct {
+	Source  string
+	Entries []Entry
+	// Truncated — в ленту вошли не все пины источника, она обрезана на TimelineSize
+	Truncated bool
+}
+
+// Page возвращает до limit пинов, идущих в ленте после after (nil — с начала), и признак, что есть еще.
+// after сравнивается по ключу сортировки, поэтому позиция сохраняется и после пересборки ленты
+func (t *Timeline) Page(after *Entry, limit int) ([]Entry, bool) {
+	start := 0
+	if after != nil {
+		start = sort.Search(len(t.Entries), func(i int) bool {
+			return !t.before(t.Entries[i], *after)
+		})
+		// Сам after в выдачу уже попал
+		if start < len(t.Entries) && !t.before(*after, t.Entries[start]) {
+			start++
+		}
+	}
+
+	end := min(start+limit, len(t.Entries))
+	return t.Entries[start:end], end < len(t.Entries)
+}
+
+// before сообщает, идет ли a в ленте раньше b
+func (t *Timeline) before(a, b Entry) bool {
+	if t.Source == SourcePopular {
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+	} else if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.PinID > b.PinID
+}
+
+func (t *Timeline) sortEntries() {
+	slices.SortFunc(t.Entries, func(a, b Entry) int {
+		if t.before(a, b) {
+			return -1
+		}
+		if t.before(b, a) {
+			return 1
+		}
+		return 0
+	})
+}
+
+type cachedTimeline struct {
+	timeline *Timeline
+	builtAt  time.Time
+	// version — users.feed_version на момент сборки
+	version int64
+}
+
+// Service собирает и кэширует ленты
+type Service struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	following map[int]cachedTimeline
+	// popular общая для всех: заблокированные авторы отфильтровываются при чтении
+	popular cachedTimeline
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:        db,
+		following: make(map[int]cachedTimeline),
+	}
+}
+
+// Timeline возвращает ленту пользователя: пины подписок или, если они ничего не дали, популярные пины
+func (s *Service) Timeline(userID int) (*Timeline, error) {
+	following, err := s.Following(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(following.Entries) > 0 {
+		return following, nil
+	}
+	return s.Popular(userID)
+}
+
+// Following возвращает ленту подписок пользователя из кэша или собирает ее заново
+func (s *Service) Following(userID int) (*Timeline, error) {
+	// Версию читаем до сборки: сброс, пришедший во время сборки, не потеряется
+	version, err := s.version(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	cached, ok := s.following[userID]
+	s.mu.Unlock()
+	if ok && cached.version == version && time.Since(cached.builtAt) < timelineTTL {
+		return cached.timeline, nil
+	}
+
+	// Собираем без блокировки: два одновременных запроса в худшем случае соберут ленту дважды
+	timeline, err := s.buildFollowing(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.following) >= maxCachedTimelines {
+		s.evictLocked()
+	}
+	s.following[userID] = cachedTimeline{timeline: timeline, builtAt: time.Now(), version: version}
+	return timeline, nil
+}
+
+// Popular возвращает популярные пины без пинов пользователя и заблокированных им авторов
+func (s *Service) Popular(userID int) (*Timeline, error) {
+	s.mu.Lock()
+	cached := s.popular
+	s.mu.Unlock()
+
+	if cached.timeline == nil || time.Since(cached.builtAt) >= timelineTTL {
+		timeline, err := s.buildPopular()
+		if err != nil {
+			return nil, err
+		}
+		cached = cachedTimeline{timeline: timeline, builtAt: time.Now()}
+		s.mu.Lock()
+		s.popular = cached
+		s.mu.Unlock()
+	}
+
+	var blocked []int
+	if err := s.db.Table("user_blocks").Where("user_id = ?", userID).Pluck("target_user_id", &blocked).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch blocked users: %w", err)
+	}
+
+	timeline := &Timeline{Source: SourcePopular, Truncated: cached.timeline.Truncated}
+	for _, e := range cached.timeline.Entries {
+		if e.UserID != userID && !slices.Contains(blocked, e.UserID) {
+			timeline.Entries = append(timeline.Entries, e)
+		}
+	}
+	return timeline, nil
+}
+
+// Invalidate сбрасывает ленту пользователя, например после изменения подписок.
+// Остальные реплики узнают о сбросе по увеличившейся users.feed_version
+func (s *Service) Invalidate(userID int) error {
+	s.mu.Lock()
+	delete(s.following, userID)
+	s.mu.Unlock()
+
+	if err := s.db.Table("users").Where("id = ?", userID).
+		Update("feed_version", gorm.Expr("feed_version + 1")).Error; err != nil {
+		return fmt.Errorf("failed to bump feed version: %w", err)
+	}
+	return nil
+}
+
+// version возвращает текущую users.feed_version пользователя
+func (s *Service) version(userID int) (int64, error) {
+	var versions []int64
+	if err := s.db.Table("users").Where("id = ?", userID).Pluck("feed_version", &versions).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch feed version: %w", err)
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[0], nil
+}
+
+// evictLocked освобождает место в кэше: сначала устаревшие ленты, если их нет — произвольную
+func (s *Service) evictLocked() {
+	for userID, cached := range s.following {
+		if time.Since(cached.builtAt) >= timelineTTL {
+			delete(s.following, userID)
+		}
+	}
+	for userID := range s.following {
+		if len(s.following) < maxCachedTimelines {
+			break
+		}
+		delete(s.following, userID)
+	}
+}
+
+// notBlocked отсекает пины авторов, заблокированных пользователем
+const notBlocked = "pins.user_id NOT IN (SELECT target_user_id FROM user_blocks WHERE user_id = ?)"
+
+// FollowingAfter читает из базы до limit пинов подписок, идущих после after, и признак, что есть еще.
+// Нужна, когда курсор ушел за пределы закэшированной ленты: порядок тот же, (created_at, id) по убыванию
+func (s *Service) FollowingAfter(userID int, after Entry, limit int) ([]Entry, bool, error) {
+	var entries []Entry
+	if err := s.db.Table("pins").
+		Select("pins.id AS pin_id, pins.user_id, pins.created_at").
+		Where(`pins.user_id IN (SELECT target_user_id FROM user_subscriptions WHERE user_id = ?)
+			OR (pins.user_id <> ? AND EXISTS (
+				SELECT 1 FROM pin_tags pt JOIN tag_subscriptions ts ON ts.tag_id = pt.tag_id
+				WHERE pt.pin_id = pins.id AND ts.user_id = ?))`, userID, userID, userID).
+		Where(notBlocked, userID).
+		Where("(pins.created_at, pins.id) < (?, ?)", after.CreatedAt, after.PinID).
+		Order("pins.created_at DESC, pins.id DESC").
+		Limit(limit + 1).
+		Scan(&entries).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to fetch older followed pins: %w", err)
+	}
+	if len(entries) > limit {
+		return entries[:limit], true, nil
+	}
+	return entries, false, nil
+}
+
+// buildFollowing читает последние пины каждого источника подписок и сливает их в одну ленту без повторов
+func (s *Service) buildFollowing(userID int) (*Timeline, error) {
+	var byUsers []Entry
+	if err := s.db.Table("pins").
+		Select("pins.id AS pin_id, pins.user_id, pins.created_at").
+		Joins("JOIN user_subscriptions s ON s.target_user_id = pins.user_id").
+		Where("s.user_id = ?", userID).
+		Where(notBlocked, userID).
+		Order("pins.created_at DESC, pins.id DESC").
+		Limit(TimelineSize).
+		Scan(&byUsers).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pins of followed users: %w", err)
+	}
+
+	var byTags []Entry
+	if err := s.db.Table("pins").
+		Select("DISTINCT pins.id AS pin_id, pins.user_id, pins.created_at").
+		Joins("JOIN pin_tags pt ON pt.pin_id = pins.id").
+		Joins("JOIN tag_subscriptions ts ON ts.tag_id = pt.tag_id").
+		Where("ts.user_id = ? AND pins.user_id <> ?", userID, userID).
+		Where(notBlocked, userID).
+		Order("pins.created_at DESC, pins.id DESC").
+		Limit(TimelineSize).
+		Scan(&byTags).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pins of followed tags: %w", err)
+	}
+
+	timeline := &Timeline{Source: SourceFollowing, Entries: make([]Entry, 0, len(byUsers)+len(byTags))}
+	seen := make(map[int]bool, len(byUsers)+len(byTags))
+	for _, e := range append(byUsers, byTags...) {
+		if !seen[e.PinID] {
+			seen[e.PinID] = true
+			timeline.Entries = append(timeline.Entries, e)
+		}
+	}
+	timeline.sortEntries()
+	// Источник, выбранный до предела, мог упереться в него: старые пины остались за лентой
+	timeline.Truncated = len(byUsers) == TimelineSize || len(byTags) == TimelineSize
+	if len(timeline.Entries) > TimelineSize {
+		timeline.Entries = timeline.Entries[:TimelineSize]
+		timeline.Truncated = true
+	}
+	return timeline, nil
+}
+
+// buildPopular собирает пины с наибольшим числом лайков и сохранений за popularWindow.
+// Если таких меньше TimelineSize, лента добирается новыми пинами с нулевым счетом
+func (s *Service) buildPopular() (*Timeline, error) {
+	timeline := &Timeline{Source: SourcePopular}
+	if err := s.db.Table("user_actions ua").
+		Select("ua.pin_id, pins.user_id, pins.created_at, COUNT(*) AS score").
+		Joins("JOIN pins ON pins.id = ua.pin_id").
+		Where("ua.action IN ? AND ua.created_at > ?", []string{"like", "save"}, time.Now().Add(-popularWindow)).
+		Group("ua.pin_id, pins.user_id, pins.created_at").
+		Order("score DESC, ua.pin_id DESC").
+		Limit(TimelineSize).
+		Scan(&timeline.Entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch popular pins: %w", err)
+	}
+
+	if missing := TimelineSize - len(timeline.Entries); missing > 0 {
+		popularIDs := make([]int, len(timeline.Entries))
+		for i, e := range timeline.Entries {
+			popularIDs[i] = e.PinID
+		}
+		query := s.db.Table("pins").Select("id AS pin_id, user_id, created_at")
+		if len(popularIDs) > 0 {
+			query = query.Where("id NOT IN ?", popularIDs)
+		}
+		var latest []Entry
+		if err := query.Order("id DESC").Limit(missing).Scan(&latest).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch latest pins: %w", err)
+		}
+		timeline.Entries = append(timeline.Entries, latest...)
+	}
+	timeline.Truncated = len(timeline.Entries) == TimelineSize
+	return timeline, nil
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ActionHandler struct {
@@ -48,7 +49,8 @@ func (h *ActionHandler) LikePin(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: time.Now(),
 	}
 
-	result := h.db.Create(&action)
+	// Повторный запрос не ошибка: уникальный индекс не даст создать дубликат
+	result := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&action)
 	if result.Error != nil {
 		log.Printf("Failed to like pin %d by user %d: %v", pinID, userID, result.Error)
 		http.Error(w, "Failed to like pin", http.StatusInternalServerError)
@@ -173,7 +175,7 @@ func (h *ActionHandler) SavePin(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: time.Now(),
 	}
 
-	result := h.db.Create(&action)
+	result := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&action)
 	if result.Error != nil {
 		log.Printf("Failed to save pin %d by user %d: %v", pinID, userID, result.Error)
 		http.Error(w, "Failed to save pin", http.StatusInternalServerError)
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"pornterest/internal/middleware"
+	"pornterest/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// requireAdmin проверяет, что текущий пользователь — модератор. При отказе сам пишет ответ
+func requireAdmin(db *gorm.DB, w http.ResponseWriter, r *http.Request) bool {
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	var user models.User
+	if err := db.Select("id", "admin").First(&user, userID).Error; err != nil {
+		log.Printf("Failed to check admin rights of user %d: %v", userID, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	if !user.Admin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pornterest/internal/feed"
+	"pornterest/internal/middleware"
+	"pornterest/internal/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockHandler обрабатывает блокировку авторов
+type BlockHandler struct {
+	db   *gorm.DB
+	feed *feed.Service
+}
+
+// NewBlockHandler создает новый экземпляр BlockHandler
+func NewBlockHandler(db *gorm.DB, timelines *feed.Service) *BlockHandler {
+	return &BlockHandler{db: db, feed: timelines}
+}
+
+// BlockUser обрабатывает HTTP POST запрос для блокировки автора. Подписка на него при этом снимается
+func (h *BlockHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+	targetUserID, err := strconv.Atoi(mux.Vars(r)["target_user_id"])
+	if err != nil {
+		http.Error(w, "Invalid target user ID", http.StatusBadRequest)
+		return
+	}
+
+	if userID == targetUserID {
+		http.Error(w, "Cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	var count int64
+	if err := h.db.Model(&models.User{}).Where("id = ?", targetUserID).Count(&count).Error; err != nil {
+		log.Printf("Failed to check user %d: %v", targetUserID, err)
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		block := models.UserBlock{
+			UserID:       userID,
+			TargetUserID: targetUserID,
+			CreatedAt:    time.Now(),
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND target_user_id = ?", userID, targetUserID).Delete(&models.UserSubscription{}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to block user %d by %d: %v", targetUserID, userID, err)
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+	invalidateFeed(h.feed, userID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Blocked successfully"})
+}
+
+// UnblockUser обрабатывает HTTP DELETE запрос для снятия блокировки
+func (h *BlockHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+	targetUserID, err := strconv.Atoi(mux.Vars(r)["target_user_id"])
+	if err != nil {
+		http.Error(w, "Invalid target user ID", http.StatusBadRequest)
+		return
+	}
+
+	result := h.db.Where("user_id = ? AND target_user_id = ?", userID, targetUserID).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		log.Printf("Failed to unblock user %d by %d: %v", targetUserID, userID, result.Error)
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+	invalidateFeed(h.feed, userID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unblocked successfully"})
+}
+
+// blockedUserIDs возвращает id авторов, заблокированных пользователем
+func blockedUserIDs(db *gorm.DB, userID int) ([]int, error) {
+	var ids []int
+	err := db.Model(&models.UserBlock{}).Where("user_id = ?", userID).Pluck("target_user_id", &ids).Error
+	return ids, err
+}
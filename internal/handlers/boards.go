@@ -0,0 +1,583 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pornterest/internal/middleware"
+	"pornterest/internal/models"
+	"pornterest/internal/storage"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// BoardHandler обрабатывает запросы, связанные с досками пользователей
+type BoardHandler struct {
+	db      *gorm.DB
+	storage storage.Storage
+}
+
+// NewBoardHandler создает новый экземпляр BoardHandler
+func NewBoardHandler(db *gorm.DB, store storage.Storage) *BoardHandler {
+	return &BoardHandler{db: db, storage: store}
+}
+
+// BoardRequest представляет данные для создания и изменения доски
+type BoardRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Secret      *bool   `json:"secret"`
+}
+
+// BoardResponse представляет доску вместе с количеством пинов на ней
+type BoardResponse struct {
+	models.Board
+	PinCount int64 `json:"pin_count"`
+}
+
+// errBoardNotFound возвращается, когда доска не существует или скрыта от текущего пользователя
+var errBoardNotFound = errors.New("board not found")
+
+// GetUserBoards обрабатывает HTTP GET запрос для получения досок пользователя по никнейму с пагинацией.
+// Секретные доски видны только их владельцу
+func (h *BoardHandler) GetUserBoards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	username := vars["username"]
+	if username == "" {
+		http.Error(w, "Username parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, page := parsePageParams(r, 20)
+	offset := (page - 1) * limit
+
+	var user models.User
+	result := h.db.Where("nickname = ?", username).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to get user by username: %v", result.Error)
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	showSecret := false
+	if viewerID, ok := middleware.UserIDFromContext(r.Context()); ok && viewerID == user.ID {
+		showSecret = true
+	}
+	boardsQuery := func() *gorm.DB {
+		query := h.db.Model(&models.Board{}).Where("user_id = ?", user.ID)
+		if !showSecret {
+			query = query.Where("secret = ?", false)
+		}
+		return query
+	}
+
+	var totalCount int64
+	if err := boardsQuery().Count(&totalCount).Error; err != nil {
+		log.Printf("Failed to count user boards: %v", err)
+		http.Error(w, "Failed to fetch user boards", http.StatusInternalServerError)
+		return
+	}
+
+	var boards []BoardResponse
+	if err := boardsQuery().
+		Select("boards.*, (SELECT COUNT(*) FROM board_pins WHERE board_pins.board_id = boards.id) AS pin_count").
+		Limit(limit).
+		Offset(offset).
+		Order("id DESC").
+		Scan(&boards).Error; err != nil {
+		log.Printf("Failed to get user boards: %v", err)
+		http.Error(w, "Failed to fetch user boards", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
+	if err := json.NewEncoder(w).Encode(boards); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetBoard обрабатывает HTTP GET запрос для получения информации о доске по ID
+func (h *BoardHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadVisibleBoard(w, r)
+	if !ok {
+		return
+	}
+
+	var pinCount int64
+	h.db.Model(&models.BoardPin{}).Where("board_id = ?", board.ID).Count(&pinCount)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(BoardResponse{Board: board, PinCount: pinCount}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CreateBoard обрабатывает HTTP POST запрос для создания доски текущего пользователя
+func (h *BoardHandler) CreateBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	var req BoardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Title == nil || strings.TrimSpace(*req.Title) == "" {
+		http.Error(w, "Board title is required", http.StatusBadRequest)
+		return
+	}
+
+	board := models.Board{
+		UserID:    userID,
+		Title:     strings.TrimSpace(*req.Title),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if req.Description != nil {
+		board.Description = *req.Description
+	}
+	if req.Secret != nil {
+		board.Secret = *req.Secret
+	}
+
+	if err := h.db.Create(&board).Error; err != nil {
+		log.Printf("Failed to create board for user %d: %v", userID, err)
+		http.Error(w, "Failed to create board", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(board)
+}
+
+// UpdateBoard обрабатывает HTTP PUT запрос для переименования доски или смены ее видимости
+func (h *BoardHandler) UpdateBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadOwnBoard(w, r)
+	if !ok {
+		return
+	}
+
+	var req BoardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			http.Error(w, "Board title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		board.Title = title
+	}
+	if req.Description != nil {
+		board.Description = *req.Description
+	}
+	if req.Secret != nil {
+		board.Secret = *req.Secret
+	}
+	board.UpdatedAt = time.Now()
+
+	if err := h.db.Save(&board).Error; err != nil {
+		log.Printf("Failed to update board %d: %v", board.ID, err)
+		http.Error(w, "Failed to update board", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(board)
+}
+
+// DeleteBoard обрабатывает HTTP DELETE запрос для удаления доски. Сами пины остаются сохраненными
+func (h *BoardHandler) DeleteBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadOwnBoard(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("board_id = ?", board.ID).Delete(&models.BoardPin{}).Error; err != nil {
+			return fmt.Errorf("failed to delete board pins: %w", err)
+		}
+		if err := tx.Delete(&models.Board{}, board.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete board: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to delete board %d: %v", board.ID, err)
+		http.Error(w, "Failed to delete board", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Board deleted successfully"})
+}
+
+// GetBoardPins обрабатывает HTTP GET запрос для получения пинов доски в пользовательском порядке с пагинацией
+func (h *BoardHandler) GetBoardPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadVisibleBoard(w, r)
+	if !ok {
+		return
+	}
+
+	limit, page := parsePageParams(r, 20)
+	offset := (page - 1) * limit
+
+	var pins []models.Pin
+	pinsResult := preloadRenditions(h.db).Joins("JOIN board_pins ON board_pins.pin_id = pins.id").
+		Where("board_pins.board_id = ?", board.ID).
+		Limit(limit).
+		Offset(offset).
+		Order("board_pins.position ASC, board_pins.id ASC").
+		Find(&pins)
+	if pinsResult.Error != nil {
+		log.Printf("Failed to get board pins: %v", pinsResult.Error)
+		http.Error(w, "Failed to fetch board pins", http.StatusInternalServerError)
+		return
+	}
+
+	var totalCount int64
+	h.db.Model(&models.BoardPin{}).Where("board_id = ?", board.ID).Count(&totalCount)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
+	if err := json.NewEncoder(w).Encode(withMediaURLs(h.storage, pins)); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// AddPinToBoards обрабатывает HTTP POST запрос для добавления пина на одну или несколько досок.
+// Пин добавляется в конец каждой доски и считается сохраненным пользователем
+func (h *BoardHandler) AddPinToBoards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	vars := mux.Vars(r)
+	pinID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		BoardIDs []int `json:"board_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.BoardIDs) == 0 {
+		http.Error(w, "At least one board ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var pinCount int64
+	if err := h.db.Model(&models.Pin{}).Where("id = ?", pinID).Count(&pinCount).Error; err != nil {
+		log.Printf("Failed to check pin %d: %v", pinID, err)
+		http.Error(w, "Failed to add pin to boards", http.StatusInternalServerError)
+		return
+	}
+	if pinCount == 0 {
+		http.Error(w, "Pin not found", http.StatusNotFound)
+		return
+	}
+
+	var ownBoards int64
+	if err := h.db.Model(&models.Board{}).Where("id IN ? AND user_id = ?", req.BoardIDs, userID).Count(&ownBoards).Error; err != nil {
+		log.Printf("Failed to check boards for user %d: %v", userID, err)
+		http.Error(w, "Failed to add pin to boards", http.StatusInternalServerError)
+		return
+	}
+	if int(ownBoards) != len(uniqueInts(req.BoardIDs)) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, boardID := range uniqueInts(req.BoardIDs) {
+			var exists int64
+			if err := tx.Model(&models.BoardPin{}).Where("board_id = ? AND pin_id = ?", boardID, pinID).Count(&exists).Error; err != nil {
+				return fmt.Errorf("failed to check board pin: %w", err)
+			}
+			if exists > 0 {
+				continue
+			}
+
+			var maxPosition *int
+			if err := tx.Model(&models.BoardPin{}).Where("board_id = ?", boardID).Select("MAX(position)").Scan(&maxPosition).Error; err != nil {
+				return fmt.Errorf("failed to get board position: %w", err)
+			}
+			position := 0
+			if maxPosition != nil {
+				position = *maxPosition + 1
+			}
+
+			boardPin := models.BoardPin{
+				BoardID:   boardID,
+				PinID:     pinID,
+				Position:  position,
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Create(&boardPin).Error; err != nil {
+				return fmt.Errorf("failed to add pin to board %d: %w", boardID, err)
+			}
+		}
+
+		// Добавление на доску — это сохранение, поэтому поддерживаем запись "save" в user_actions
+		save := models.UserAction{
+			UserID:    userID,
+			PinID:     pinID,
+			Action:    "save",
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Where("user_id = ? AND pin_id = ? AND action = ?", userID, pinID, "save").FirstOrCreate(&save).Error; err != nil {
+			return fmt.Errorf("failed to save pin: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to add pin %d to boards by user %d: %v", pinID, userID, err)
+		http.Error(w, "Failed to add pin to boards", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pin added to boards successfully"})
+}
+
+// RemovePinFromBoard обрабатывает HTTP DELETE запрос для удаления пина с доски
+func (h *BoardHandler) RemovePinFromBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadOwnBoard(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	pinID, err := strconv.Atoi(vars["pin_id"])
+	if err != nil {
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
+		return
+	}
+
+	result := h.db.Where("board_id = ? AND pin_id = ?", board.ID, pinID).Delete(&models.BoardPin{})
+	if result.Error != nil {
+		log.Printf("Failed to remove pin %d from board %d: %v", pinID, board.ID, result.Error)
+		http.Error(w, "Failed to remove pin from board", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Pin not found on board", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pin removed from board successfully"})
+}
+
+// ReorderBoardPins обрабатывает HTTP PUT запрос для изменения порядка пинов на доске.
+// Переданные пины встают в начало доски в указанном порядке, остальные сохраняют свой относительный порядок после них
+func (h *BoardHandler) ReorderBoardPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	board, ok := h.loadOwnBoard(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PinIDs []int `json:"pin_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var boardPins []models.BoardPin
+	if err := h.db.Where("board_id = ?", board.ID).Order("position ASC, id ASC").Find(&boardPins).Error; err != nil {
+		log.Printf("Failed to get board pins: %v", err)
+		http.Error(w, "Failed to reorder board pins", http.StatusInternalServerError)
+		return
+	}
+
+	byPinID := make(map[int]models.BoardPin, len(boardPins))
+	for _, bp := range boardPins {
+		byPinID[bp.PinID] = bp
+	}
+
+	ordered := make([]models.BoardPin, 0, len(boardPins))
+	placed := make(map[int]bool, len(req.PinIDs))
+	for _, pinID := range req.PinIDs {
+		bp, ok := byPinID[pinID]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Pin %d is not on this board", pinID), http.StatusBadRequest)
+			return
+		}
+		if placed[pinID] {
+			continue
+		}
+		placed[pinID] = true
+		ordered = append(ordered, bp)
+	}
+	for _, bp := range boardPins {
+		if !placed[bp.PinID] {
+			ordered = append(ordered, bp)
+		}
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for position, bp := range ordered {
+			if bp.Position == position {
+				continue
+			}
+			if err := tx.Model(&models.BoardPin{}).Where("id = ?", bp.ID).Update("position", position).Error; err != nil {
+				return fmt.Errorf("failed to update position of pin %d: %w", bp.PinID, err)
+			}
+		}
+		return tx.Model(&models.Board{}).Where("id = ?", board.ID).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		log.Printf("Failed to reorder board %d: %v", board.ID, err)
+		http.Error(w, "Failed to reorder board pins", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Board pins reordered successfully"})
+}
+
+// loadVisibleBoard загружает доску из URL и скрывает секретные доски от всех, кроме владельца.
+// При ошибке сам пишет ответ и возвращает false
+func (h *BoardHandler) loadVisibleBoard(w http.ResponseWriter, r *http.Request) (models.Board, bool) {
+	board, err := h.findBoard(r)
+	if err == nil && board.Secret {
+		if viewerID, ok := middleware.UserIDFromContext(r.Context()); !ok || viewerID != board.UserID {
+			err = errBoardNotFound
+		}
+	}
+	return board, h.handleBoardError(w, board, err)
+}
+
+// loadOwnBoard загружает доску из URL и проверяет, что она принадлежит текущему пользователю.
+// При ошибке сам пишет ответ и возвращает false
+func (h *BoardHandler) loadOwnBoard(w http.ResponseWriter, r *http.Request) (models.Board, bool) {
+	board, err := h.findBoard(r)
+	if !h.handleBoardError(w, board, err) {
+		return board, false
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+	if board.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return board, false
+	}
+	return board, true
+}
+
+func (h *BoardHandler) findBoard(r *http.Request) (models.Board, error) {
+	var board models.Board
+
+	vars := mux.Vars(r)
+	boardID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return board, fmt.Errorf("invalid board ID: %w", err)
+	}
+
+	if err := h.db.First(&board, boardID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return board, errBoardNotFound
+		}
+		return board, err
+	}
+	return board, nil
+}
+
+func (h *BoardHandler) handleBoardError(w http.ResponseWriter, board models.Board, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errBoardNotFound):
+		http.Error(w, "Board not found", http.StatusNotFound)
+	case errors.Is(err, strconv.ErrSyntax), errors.Is(err, strconv.ErrRange):
+		http.Error(w, "Invalid board ID", http.StatusBadRequest)
+	default:
+		log.Printf("Failed to fetch board %d: %v", board.ID, err)
+		http.Error(w, "Failed to fetch board", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// uniqueInts возвращает значения без повторов, сохраняя порядок
+func uniqueInts(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	result := make([]int, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pornterest/internal/hashindex"
+	"pornterest/internal/media"
+	"pornterest/internal/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// DuplicatePin — пин из кластера дубликатов и его расстояние до запрошенного пина
+type DuplicatePin struct {
+	models.Pin
+	Distance int `json:"distance"`
+}
+
+// GetPinDuplicatesResponse описывает кластер визуально совпадающих пинов
+type GetPinDuplicatesResponse struct {
+	PinID      int            `json:"pin_id"`
+	RootID     int            `json:"root_id"`
+	Duplicates []DuplicatePin `json:"duplicates"`
+}
+
+// findOwnDuplicate ищет у пользователя уже загруженный пин с близким перцептивным хэшем
+func findOwnDuplicate(db *gorm.DB, index *hashindex.Index, userID int, hash uint64) (*models.Pin, error) {
+	candidates := matchPinIDs(index.Search(hash, media.DuplicateThreshold, 0))
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var pin models.Pin
+	err := db.Where("id IN ? AND user_id = ?", candidates, userID).Order("id ASC").First(&pin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// findOriginalPin ищет самый ранний пин с близким хэшем среди чужих загрузок — это оригинал,
+// к которому привязывается репост
+func findOriginalPin(db *gorm.DB, index *hashindex.Index, userID int, hash uint64) (*int, error) {
+	candidates := matchPinIDs(index.Search(hash, media.DuplicateThreshold, 0))
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var pin models.Pin
+	err := db.
+		Select("id", "duplicate_of_id").
+		Where("id IN ? AND user_id <> ?", candidates, userID).
+		Order("id ASC").
+		First(&pin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Самый ранний найденный пин может сам быть репостом — кластер всегда указывает на корень
+	if pin.DuplicateOfID != nil {
+		return pin.DuplicateOfID, nil
+	}
+	return &pin.ID, nil
+}
+
+func matchPinIDs(matches []hashindex.Match) []int {
+	ids := make([]int, len(matches))
+	for i, m := range matches {
+		ids[i] = m.PinID
+	}
+	return ids
+}
+
+// GetPinDuplicates обрабатывает HTTP GET запрос модератора для просмотра кластера дубликатов пина
+func (h *PinHandler) GetPinDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireAdmin(h.db, w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	pinID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
+		return
+	}
+
+	var pin models.Pin
+	if err := h.db.First(&pin, pinID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Pin not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to fetch pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch pin", http.StatusInternalServerError)
+		return
+	}
+
+	rootID := pin.ID
+	if pin.DuplicateOfID != nil {
+		rootID = *pin.DuplicateOfID
+	}
+
+	// Кластер — корень, все привязанные к нему репосты и пины с близким хэшем,
+	// загруженные до появления поиска дубликатов
+	query := preloadRenditions(h.db).Where("id = ? OR duplicate_of_id = ?", rootID, rootID)
+	if pin.PHash != nil {
+		if similar := matchPinIDs(h.hashIndex.Search(uint64(*pin.PHash), media.DuplicateThreshold, 0)); len(similar) > 0 {
+			query = query.Or("id IN ?", similar)
+		}
+	}
+
+	var pins []models.Pin
+	if err := query.Order("id ASC").Find(&pins).Error; err != nil {
+		log.Printf("Failed to fetch duplicates of pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch duplicates", http.StatusInternalServerError)
+		return
+	}
+
+	duplicates := make([]DuplicatePin, 0, len(pins))
+	for _, p := range withMediaURLs(h.storage, pins) {
+		if p.ID == pin.ID {
+			continue
+		}
+		distance := -1
+		if pin.PHash != nil && p.PHash != nil {
+			distance = media.HammingDistance(uint64(*pin.PHash), uint64(*p.PHash))
+		}
+		duplicates = append(duplicates, DuplicatePin{Pin: p, Distance: distance})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GetPinDuplicatesResponse{
+		PinID:      pin.ID,
+		RootID:     rootID,
+		Duplicates: duplicates,
+	}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"pornterest/internal/feed"
+	"pornterest/internal/middleware"
+	"pornterest/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// FeedHandler обрабатывает запросы домашней ленты
+type FeedHandler struct {
+	db      *gorm.DB
+	storage storage.Storage
+	feed    *feed.Service
+}
+
+// NewFeedHandler создает новый экземпляр FeedHandler
+func NewFeedHandler(db *gorm.DB, store storage.Storage, timelines *feed.Service) *FeedHandler {
+	return &FeedHandler{db: db, storage: store, feed: timelines}
+}
+
+// FeedResponse — страница ленты. source — following (подписки) или popular (подписки пока ничего не дали).
+// Популярная лента ограничена feed.TimelineSize пинов: на ее последней странице truncated сообщает,
+// что популярных пинов больше, чем показано. Лента подписок листается до самого старого пина
+type FeedResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor *string     `json:"next_cursor"`
+	Source     string      `json:"source"`
+	Truncated  bool        `json:"truncated"`
+}
+
+// GetFeed отдает домашнюю ленту текущего пользователя страницами по cursor
+func (h *FeedHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	pageReq, err := parsePageRequest(r, 20)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	// Курсор ленты подписок хранит время пина, популярной — счет. Следующие страницы читаются
+	// из той же ленты, даже если за это время появились подписки
+	var timeline *feed.Timeline
+	var after *feed.Entry
+	switch {
+	case pageReq.After == nil:
+		timeline, err = h.feed.Timeline(userID)
+	case pageReq.After.Time != nil:
+		timeline, err = h.feed.Following(userID)
+		after = &feed.Entry{PinID: pageReq.After.ID, CreatedAt: *pageReq.After.Time}
+	default:
+		timeline, err = h.feed.Popular(userID)
+		after = &feed.Entry{PinID: pageReq.After.ID, Score: int(pageReq.After.Value)}
+	}
+	if err != nil {
+		log.Printf("Failed to build feed for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+		return
+	}
+
+	entries, more := timeline.Page(after, pageReq.Limit)
+	if timeline.Source == feed.SourceFollowing && !more && timeline.Truncated {
+		// Закэшированная лента кончилась на пределе, дальше подписки читаются из базы
+		from := after
+		if len(entries) > 0 {
+			from = &entries[len(entries)-1]
+		}
+		if from != nil {
+			older, olderMore, err := h.feed.FollowingAfter(userID, *from, pageReq.Limit-len(entries))
+			if err != nil {
+				log.Printf("Failed to fetch older feed pins for user %d: %v", userID, err)
+				http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+				return
+			}
+			// entries смотрит в закэшированную ленту: дописываем в копию, а не в нее
+			entries, more = append(slices.Clip(entries), older...), olderMore
+		}
+	}
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PinID
+	}
+	pins, err := loadPinsByIDs(h.db, ids)
+	if err != nil {
+		log.Printf("Failed to fetch feed pins for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+		return
+	}
+
+	response := FeedResponse{Items: withMediaURLs(h.storage, pins), Source: timeline.Source}
+	if more {
+		last := entries[len(entries)-1]
+		cursor := pageCursor{ID: last.PinID}
+		if timeline.Source == feed.SourcePopular {
+			cursor.Value = int64(last.Score)
+		} else {
+			cursor.Time = &last.CreatedAt
+		}
+		next := encodeCursor(cursor)
+		response.NextCursor = &next
+	} else if timeline.Source == feed.SourcePopular {
+		response.Truncated = timeline.Truncated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// invalidateFeed сбрасывает ленту пользователя после изменения его подписок или блокировок.
+// Ошибка только логируется: устаревшая лента сама пересоберется через TTL
+func invalidateFeed(timelines *feed.Service, userID int) {
+	if err := timelines.Invalidate(userID); err != nil {
+		log.Printf("Failed to invalidate feed of user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxPageLimit — больше этого количества элементов список за один запрос не отдает
+const maxPageLimit = 100
+
+// errInvalidCursor возвращается для поврежденного или чужого курсора
+var errInvalidCursor = errors.New("invalid cursor")
+
+// parsePageParams разбирает параметры limit и page из строки запроса
+func parsePageParams(r *http.Request, defaultLimit int) (limit int, page int) {
+	limit = defaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err == nil && l > 0 {
+			limit = l
+		}
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	page = 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		p, err := strconv.Atoi(pageStr)
+		if err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	return limit, page
+}
+
+// pageCursor — позиция в выдаче для keyset-пагинации: ключ сортировки последнего элемента и его id.
+// Клиенту отдается в виде непрозрачной строки
+type pageCursor struct {
+	Time  *time.Time `json:"t,omitempty"`
+	Value int64      `json:"v,omitempty"`
+	ID    int        `json:"id"`
+}
+
+// pageRequest — параметры запроса страницы списка
+type pageRequest struct {
+	Limit int
+	Page  int
+	// CursorMode — клиент передал cursor (пустой для первой страницы) и ждет ответ с next_cursor
+	CursorMode bool
+	// After — позиция, после которой начинается страница; nil для первой страницы
+	After *pageCursor
+}
+
+// Offset возвращает смещение для режима page/limit
+func (p pageRequest) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// parsePageRequest разбирает limit, page и cursor из строки запроса
+func parsePageRequest(r *http.Request, defaultLimit int) (pageRequest, error) {
+	limit, page := parsePageParams(r, defaultLimit)
+	req := pageRequest{Limit: limit, Page: page}
+
+	values, ok := r.URL.Query()["cursor"]
+	if !ok {
+		return req, nil
+	}
+	req.CursorMode = true
+	if values[0] == "" {
+		return req, nil
+	}
+
+	cursor, err := decodeCursor(values[0])
+	if err != nil {
+		return req, err
+	}
+	req.After = &cursor
+	return req, nil
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return pageCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorPage — ответ списка в режиме курсора. next_cursor равен null на последней странице
+type cursorPage struct {
+	Items      interface{} `json:"items"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+// nextCursor возвращает курсор следующей страницы, если элементов выбрано больше limit
+// (запрос делается с limit+1), иначе nil. cursorOf строит курсор по последнему элементу страницы
+func nextCursor(fetched, limit int, cursorOf func(last int) pageCursor) *string {
+	if fetched <= limit {
+		return nil
+	}
+	next := encodeCursor(cursorOf(limit - 1))
+	return &next
+}
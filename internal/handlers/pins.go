@@ -1,19 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"pornterest/internal/elasticsearch"
+	"pornterest/internal/hashindex"
+	"pornterest/internal/media"
 	"pornterest/internal/middleware"
 	"pornterest/internal/models"
+	"pornterest/internal/outbox"
+	"pornterest/internal/storage"
 	"pornterest/internal/tasks"
 
 	"github.com/gorilla/mux"
@@ -25,18 +31,24 @@ type PinHandler struct {
 	db        *gorm.DB
 	taskQueue *tasks.TaskQueue
 	es        *elasticsearch.ESClient
+	storage   storage.Storage
+	hashIndex *hashindex.Index
 }
 
-type SearchPinsResponse struct {
-	PinIDs []int `json:"pin_ids"`
-	Total  int   `json:"total"`
-}
+// Параметры обратного поиска по изображению
+const (
+	imageSearchDefaultDistance = 12
+	imageSearchMaxDistance     = 20
+	imageSearchLimit           = 200
+)
 
-func NewPinHandler(db *gorm.DB, taskQueue *tasks.TaskQueue, es *elasticsearch.ESClient) *PinHandler {
+func NewPinHandler(db *gorm.DB, taskQueue *tasks.TaskQueue, es *elasticsearch.ESClient, store storage.Storage, hashIndex *hashindex.Index) *PinHandler {
 	return &PinHandler{
 		db:        db,
 		taskQueue: taskQueue,
 		es:        es,
+		storage:   store,
+		hashIndex: hashIndex,
 	}
 }
 
@@ -47,28 +59,14 @@ func (h *PinHandler) GetPins(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	pageStr := r.URL.Query().Get("page")
 	pinIDsStr := r.URL.Query().Get("ids") // Новый параметр
 
-	limit := 10 // Значение по умолчанию
-	if limitStr != "" {
-		l, err := strconv.Atoi(limitStr)
-		if err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	page := 1 // Значение по умолчанию
-	if pageStr != "" {
-		p, err := strconv.Atoi(pageStr)
-		if err == nil && p > 0 {
-			page = p
-		}
+	pageReq, err := parsePageRequest(r, 10)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
-	offset := (page - 1) * limit
-
 	query := h.db.Model(&models.Pin{})
 
 	// Если переданы ID пинов, фильтруем по ним
@@ -81,8 +79,33 @@ func (h *PinHandler) GetPins(w http.ResponseWriter, r *http.Request) {
 		query = query.Where("id IN ?", pinIDs)
 	}
 
+	if pageReq.CursorMode {
+		// Курсор — id последнего пина: новые загрузки не сдвигают следующие страницы
+		if pageReq.After != nil {
+			query = query.Where("id < ?", pageReq.After.ID)
+		}
+
+		var pins []models.Pin
+		if err := preloadRenditions(query).Limit(pageReq.Limit + 1).Order("id DESC").Find(&pins).Error; err != nil {
+			http.Error(w, "Failed to fetch pins", http.StatusInternalServerError)
+			log.Printf("Failed to fetch pins: %v", err)
+			return
+		}
+
+		next := nextCursor(len(pins), pageReq.Limit, func(last int) pageCursor {
+			return pageCursor{ID: pins[last].ID}
+		})
+		if len(pins) > pageReq.Limit {
+			pins = pins[:pageReq.Limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cursorPage{Items: withMediaURLs(h.storage, pins), NextCursor: next})
+		return
+	}
+
 	var pins []models.Pin
-	result := query.Limit(limit).Offset(offset).Order("id DESC").Find(&pins)
+	result := preloadRenditions(query).Limit(pageReq.Limit).Offset(pageReq.Offset()).Order("id DESC").Find(&pins)
 	if result.Error != nil {
 		http.Error(w, "Failed to fetch pins", http.StatusInternalServerError)
 		log.Printf("Failed to fetch pins: %v", result.Error)
@@ -90,7 +113,7 @@ func (h *PinHandler) GetPins(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(pins); err != nil {
+	if err := json.NewEncoder(w).Encode(withMediaURLs(h.storage, pins)); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -112,7 +135,7 @@ func (h *PinHandler) GetPin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var pin models.Pin
-	result := h.db.First(&pin, pinID)
+	result := preloadRenditions(h.db).First(&pin, pinID)
 	if result.Error != nil {
 		if gorm.ErrRecordNotFound == result.Error {
 			http.Error(w, "Pin not found", http.StatusNotFound)
@@ -123,6 +146,8 @@ func (h *PinHandler) GetPin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	withMediaURL(h.storage, &pin)
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(pin); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -147,223 +172,629 @@ func (h *PinHandler) UploadPin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем текстовые поля
-	title := r.FormValue("title")
-	description := r.FormValue("description")
-	original := r.FormValue("link")
-	allowCommentsStr := r.FormValue("allowComments")
-	isAiGeneratedStr := r.FormValue("isAiGenerated")
-	widthStr := r.FormValue("width")
-	heightStr := r.FormValue("height")
-	durationStr := r.FormValue("duration")
+	// Получаем файл
+	file, fileHeader, err := r.FormFile("media")
+	if err != nil {
+		http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
 
-	// Обработка булевых значений
-	allowComments := strings.ToLower(allowCommentsStr) == "true"
-	isAiGenerated := strings.ToLower(isAiGeneratedStr) == "true"
+	// Получаем текстовые поля, булевы значения приходят строками "true"/"false"
+	upload := pinUpload{
+		Title:         r.FormValue("title"),
+		Description:   r.FormValue("description"),
+		Link:          r.FormValue("link"),
+		AllowComments: strings.ToLower(r.FormValue("allowComments")) == "true",
+		IsAiGenerated: strings.ToLower(r.FormValue("isAiGenerated")) == "true",
+		Tags:          r.FormValue("tags"),
+		FileName:      fileHeader.Filename,
+		File:          file,
+		Size:          fileHeader.Size,
+	}
+
+	pin, uploadErr := h.createPin(r.Context(), userID, upload)
+	if uploadErr != nil {
+		writeUploadError(w, uploadErr)
+		return
+	}
 
-	// Обработка числовых значений
-	var width *int
-	if widthStr != "" {
-		wVal, err := strconv.Atoi(widthStr)
-		if err == nil {
-			width = &wVal
-		} else {
-			log.Printf("Failed to parse width: %v", err)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pin uploaded successfully", "path": h.storage.URL(pin.Path), "id": fmt.Sprintf("%d", pin.ID)})
+}
+
+// pinUpload — поля нового пина, общие для обычной и возобновляемой (tus) загрузки
+type pinUpload struct {
+	Title         string
+	Description   string
+	Link          string
+	AllowComments bool
+	IsAiGenerated bool
+	Tags          string // JSON-массив названий тегов в том виде, в котором его присылает клиент
+	FileName      string
+	File          io.ReadSeeker
+	Size          int64
+}
+
+// uploadError — ошибка создания пина вместе со статусом, который нужно вернуть клиенту
+type uploadError struct {
+	Status      int
+	Message     string
+	DuplicateOf int // ID своего пина с тем же изображением, если загрузка отклонена как повторная
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+// writeUploadError отправляет клиенту ошибку создания пина
+func writeUploadError(w http.ResponseWriter, err *uploadError) {
+	if err.DuplicateOf != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(err.Status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      err.Message,
+			"duplicate_of": err.DuplicateOf,
+		})
+		return
+	}
+	http.Error(w, err.Message, err.Status)
+}
+
+// createPin проверяет загруженный файл, сохраняет его в хранилище и создает пин с тегами.
+// Используется и обычной загрузкой, и завершением возобновляемой загрузки
+func (h *PinHandler) createPin(ctx context.Context, userID int, upload pinUpload) (*models.Pin, *uploadError) {
+	file := upload.File
+
+	// Теги разбираем до сохранения файла: пин создается вместе с тегами или не создается вовсе
+	var tagTitles []string
+	if upload.Tags != "" {
+		if err := json.Unmarshal([]byte(upload.Tags), &tagTitles); err != nil {
+			return nil, &uploadError{Status: http.StatusBadRequest, Message: "Invalid tags"}
 		}
 	}
 
-	var height *int
-	if heightStr != "" {
-		hVal, err := strconv.Atoi(heightStr)
-		if err == nil {
-			height = &hVal
-		} else {
-			log.Printf("Failed to parse height: %v", err)
+	// Тип, размеры и длительность определяем по содержимому файла, а не по данным клиента
+	info, err := media.Inspect(file)
+	if err != nil {
+		if errors.Is(err, media.ErrAnimatedWebP) {
+			return nil, &uploadError{Status: http.StatusUnsupportedMediaType, Message: "Animated WebP is not supported, upload it as GIF or video"}
+		}
+		if errors.Is(err, media.ErrUnsupportedType) {
+			return nil, &uploadError{Status: http.StatusUnsupportedMediaType, Message: "Unsupported media type"}
 		}
+		log.Printf("Failed to inspect uploaded media: %v", err)
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: "Invalid media file"}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Failed to rewind uploaded file: %v", err)
+		return nil, &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save file"}
+	}
+
+	// Дальше работаем с src: для изображений это копия без EXIF/GPS и прочих метаданных,
+	// уже развернутая согласно EXIF Orientation, поэтому и размеры берем из нее
+	var src io.ReadSeeker = file
+	size := upload.Size
+	if info.Type == media.TypeImage {
+		sanitized, err := media.Sanitize(file, info)
+		if err != nil {
+			log.Printf("Failed to strip image metadata: %v", err)
+			return nil, &uploadError{Status: http.StatusBadRequest, Message: "Invalid media file"}
+		}
+		src = bytes.NewReader(sanitized.Data)
+		size = int64(len(sanitized.Data))
+		info.MIME, info.Ext = sanitized.MIME, sanitized.Ext
+		info.Width, info.Height = sanitized.Width, sanitized.Height
+	}
+
+	// Для изображений считаем перцептивный хэш: повторная загрузка своего же изображения отклоняется,
+	// а чужое изображение привязывается к самому раннему пину-оригиналу.
+	// Заодно извлекаем палитру для поиска по цвету и BlurHash для заглушки в сетке
+	var phash *int64
+	var duplicateOfID *int
+	var palette []string
+	var blurHash *string
+	if info.Type == media.TypeImage || info.Type == media.TypeGIF {
+		appearance, err := media.Analyze(src)
+		if err != nil {
+			log.Printf("Failed to analyze uploaded image: %v", err)
+			return nil, &uploadError{Status: http.StatusBadRequest, Message: "Invalid media file"}
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			log.Printf("Failed to rewind uploaded file: %v", err)
+			return nil, &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save file"}
+		}
+		hash := appearance.PHash
+
+		own, err := findOwnDuplicate(h.db, h.hashIndex, userID, hash)
+		if err != nil {
+			log.Printf("Failed to check duplicates for user %d: %v", userID, err)
+			return nil, &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save pin info"}
+		}
+		if own != nil {
+			return nil, &uploadError{Status: http.StatusConflict, Message: "You have already uploaded this image", DuplicateOf: own.ID}
+		}
+
+		duplicateOfID, err = findOriginalPin(h.db, h.hashIndex, userID, hash)
+		if err != nil {
+			log.Printf("Failed to look up original pin: %v", err)
+		}
+
+		signed := int64(hash)
+		phash = &signed
+		palette = appearance.Palette
+		blurHash = &appearance.BlurHash
+	}
+
+	// Генерируем уникальное имя файла, расширение берем из настоящего формата
+	timestamp := time.Now().UnixNano()
+	newFilename := fmt.Sprintf("%d_%d%s", userID, timestamp, info.Ext)
+
+	// Сохраняем файл в хранилище
+	if err := h.storage.Put(ctx, newFilename, src, size, info.MIME); err != nil {
+		log.Printf("Failed to store file: %v", err)
+		return nil, &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save file"}
 	}
 
+	fileType := info.Type
+	width := info.Width
+	height := info.Height
 	var duration *float64
-	if durationStr != "" {
-		dVal, err := strconv.ParseFloat(durationStr, 64)
-		if err == nil {
-			duration = &dVal
-		} else {
-			log.Printf("Failed to parse duration: %v", err)
+	if info.Type == media.TypeVideo {
+		duration = &info.Duration
+	}
+
+	// Сохраняем информацию о пине в базе данных
+	original := upload.Link
+	allowComments := upload.AllowComments
+	isAiGenerated := upload.IsAiGenerated
+	fileName := upload.FileName
+	pin := &models.Pin{
+		Path:             newFilename, // В базе храним только ключ, URL строится при ответе
+		Description:      upload.Description,
+		UserID:           userID,
+		Original:         &original,
+		Comment:          &allowComments,
+		Ai:               &isAiGenerated,
+		Type:             &fileType,
+		Title:            upload.Title,
+		Width:            &width,
+		Height:           &height,
+		Duration:         duration,
+		OriginalFileName: &fileName,
+		PHash:            phash,
+		DuplicateOfID:    duplicateOfID,
+		Palette:          palette,
+		BlurHash:         blurHash,
+		CreatedAt:        time.Now(), // GORM может делать это автоматически
+		UpdatedAt:        time.Now(), // GORM может делать это автоматически
+	}
+
+	// Пин, его теги со счетчиками и событие для поискового индекса сохраняются атомарно
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(pin).Error; err != nil {
+			return fmt.Errorf("failed to save pin: %w", err)
+		}
+		if err := syncPinTags(tx, pin.ID, tagTitles); err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, outbox.EventIndexPin, pin.ID)
+	})
+	if err != nil {
+		log.Printf("Failed to save pin info to database: %v", err)
+		if err := h.storage.Delete(ctx, newFilename); err != nil {
+			log.Printf("Failed to remove orphaned media %s: %v", newFilename, err)
 		}
+		return nil, &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save pin info"}
 	}
 
-	// Получаем файл
-	file, fileHeader, err := r.FormFile("media")
+	if pin.PHash != nil {
+		h.hashIndex.Add(pin.ID, uint64(*pin.PHash))
+	}
+
+	// Генерируем уменьшенные копии для сетки и детальной страницы. Ошибка не мешает созданию пина:
+	// недостающие копии можно догенерировать командой backfill-renditions
+	if info.Type == media.TypeImage {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			log.Printf("Failed to rewind uploaded file: %v", err)
+		} else if renditions, err := media.StoreRenditions(ctx, h.storage, pin.ID, newFilename, src); err != nil {
+			log.Printf("Failed to generate renditions for pin %d: %v", pin.ID, err)
+		} else if len(renditions) > 0 {
+			if err := h.db.Create(&renditions).Error; err != nil {
+				log.Printf("Failed to save renditions for pin %d: %v", pin.ID, err)
+			}
+		}
+	}
+
+	return pin, nil
+}
+
+// UpdatePinRequest представляет изменяемые поля пина. Отсутствующие поля не меняются
+type UpdatePinRequest struct {
+	Title         *string   `json:"title"`
+	Description   *string   `json:"description"`
+	Link          *string   `json:"link"`
+	AllowComments *bool     `json:"allowComments"`
+	IsAiGenerated *bool     `json:"isAiGenerated"`
+	Tags          *[]string `json:"tags"`
+}
+
+// UpdatePin обрабатывает HTTP PUT запрос для редактирования пина его владельцем
+func (h *PinHandler) UpdatePin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	vars := mux.Vars(r)
+	pinID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	// Создаем директорию /upload, если ее нет
-	uploadDir := "upload"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		err = os.Mkdir(uploadDir, os.ModeDir|0755)
-		if err != nil {
-			log.Printf("Failed to create upload directory: %v", err)
-			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+	var req UpdatePinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var pin models.Pin
+	if err := h.db.First(&pin, pinID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Pin not found", http.StatusNotFound)
 			return
 		}
+		log.Printf("Failed to fetch pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch pin", http.StatusInternalServerError)
+		return
 	}
 
-	// Генерируем уникальное имя файла
-	timestamp := time.Now().UnixNano()
-	filenameParts := strings.Split(fileHeader.Filename, ".")
-	var fileExtension string
-	if len(filenameParts) > 1 {
-		fileExtension = "." + filenameParts[len(filenameParts)-1]
+	if pin.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
 	}
-	newFilename := fmt.Sprintf("%d_%d%s", userID, timestamp, fileExtension)
-	filePath := fmt.Sprintf("%s/%s", uploadDir, newFilename)
 
-	// Сохраняем файл на сервере
-	dst, err := os.Create(filePath)
+	if req.Title != nil {
+		pin.Title = *req.Title
+	}
+	if req.Description != nil {
+		pin.Description = *req.Description
+	}
+	if req.Link != nil {
+		pin.Original = req.Link
+	}
+	if req.AllowComments != nil {
+		pin.Comment = req.AllowComments
+	}
+	if req.IsAiGenerated != nil {
+		pin.Ai = req.IsAiGenerated
+	}
+	pin.UpdatedAt = time.Now()
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Comments", "Tags", "Renditions").Save(&pin).Error; err != nil {
+			return fmt.Errorf("failed to save pin: %w", err)
+		}
+		if req.Tags != nil {
+			if err := syncPinTags(tx, pin.ID, *req.Tags); err != nil {
+				return err
+			}
+		}
+		return outbox.Enqueue(tx, outbox.EventIndexPin, pin.ID)
+	})
 	if err != nil {
-		log.Printf("Failed to create file on server: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		log.Printf("Failed to update pin %d: %v", pinID, err)
+		http.Error(w, "Failed to update pin", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.db.Where("pin_id = ?", pin.ID).Order("width ASC").Find(&pin.Renditions).Error; err != nil {
+		log.Printf("Failed to fetch renditions for pin %d: %v", pin.ID, err)
+	}
+	withMediaURL(h.storage, &pin)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pin); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeletePin обрабатывает HTTP DELETE запрос для удаления пина его владельцем
+func (h *PinHandler) DeletePin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, file)
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	vars := mux.Vars(r)
+	pinID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		log.Printf("Failed to copy file to server: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
 		return
 	}
 
-	// Определяем тип файла (image, video, gif) на основе Content-Type
-	contentType := fileHeader.Header.Get("Content-Type")
-	var fileType *string
-	if strings.HasPrefix(contentType, "image/") {
-		t := "image"
-		fileType = &t
-	} else if strings.HasPrefix(contentType, "video/") {
-		t := "video"
-		fileType = &t
-	} else if contentType == "image/gif" {
-		t := "gif"
-		fileType = &t
+	var pin models.Pin
+	if err := h.db.First(&pin, pinID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Pin not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to fetch pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch pin", http.StatusInternalServerError)
+		return
 	}
 
-	// Сохраняем информацию о пине в базе данных
-	pin := &models.Pin{
-		Path:             "http://localhost:8080/" + filePath,
-		Description:      description,
-		UserID:           userID,
-		Original:         &original,
-		Comment:          &allowComments,
-		Ai:               &isAiGenerated,
-		Type:             fileType,
-		Title:            title,
-		Width:            width,
-		Height:           height,
-		Duration:         duration,
-		OriginalFileName: &fileHeader.Filename,
-		CreatedAt:        time.Now(), // GORM может делать это автоматически
-		UpdatedAt:        time.Now(), // GORM может делать это автоматически
+	if pin.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
 	}
 
-	result := h.db.Create(pin)
-	if result.Error != nil {
-		log.Printf("Failed to save pin info to database: %v", result.Error)
-		http.Error(w, "Failed to save pin info", http.StatusInternalServerError)
+	var renditions []models.PinRendition
+	if err := h.db.Where("pin_id = ?", pin.ID).Find(&renditions).Error; err != nil {
+		log.Printf("Failed to fetch renditions for pin %d: %v", pin.ID, err)
+		http.Error(w, "Failed to delete pin", http.StatusInternalServerError)
 		return
 	}
 
-	tagsStr := r.FormValue("tags")
-	if tagsStr != "" {
-		var tags []string
-		if err := json.Unmarshal([]byte(tagsStr), &tags); err != nil {
-			log.Printf("Failed to parse tags: %v", err)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Снимаем теги, чтобы счетчики тегов остались согласованными
+		if err := syncPinTags(tx, pin.ID, nil); err != nil {
+			return err
+		}
+		if err := tx.Where("pin_id = ?", pin.ID).Delete(&models.UserAction{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pin actions: %w", err)
+		}
+		if err := tx.Where("pin_id = ?", pin.ID).Delete(&models.Comment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pin comments: %w", err)
+		}
+		if err := tx.Where("pin_id = ?", pin.ID).Delete(&models.BoardPin{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pin from boards: %w", err)
+		}
+		if err := tx.Where("pin_id = ?", pin.ID).Delete(&models.PinRendition{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pin renditions: %w", err)
+		}
+		if err := tx.Delete(&models.Pin{}, pin.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete pin: %w", err)
+		}
+		return outbox.Enqueue(tx, outbox.EventDeletePin, pin.ID)
+	})
+	if err != nil {
+		log.Printf("Failed to delete pin %d: %v", pinID, err)
+		http.Error(w, "Failed to delete pin", http.StatusInternalServerError)
+		return
+	}
+
+	// Файлы удаляем после коммита: их потеря не должна откатывать удаление пина.
+	// Документ из индекса удалит обработчик outbox
+	keys := []string{storage.KeyFromPath(pin.Path)}
+	for _, rendition := range renditions {
+		keys = append(keys, rendition.Key)
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := h.storage.Delete(r.Context(), key); err != nil {
+			log.Printf("Failed to remove media %s: %v", key, err)
+		}
+	}
+
+	h.hashIndex.Remove(pin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pin deleted successfully"})
+}
+
+// syncPinTags приводит набор тегов пина к переданному списку title_model,
+// поддерживая pin_tags и счетчики Tag.Count. Пустой список снимает все теги
+func syncPinTags(tx *gorm.DB, pinID int, tagTitles []string) error {
+	current, err := fetchPinTags(tx, pinID)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(tagTitles))
+	for _, title := range tagTitles {
+		title = strings.TrimSpace(title)
+		if title != "" {
+			wanted[title] = true
+		}
+	}
+
+	existing := make(map[string]bool, len(current))
+	var removedIDs []int
+	for _, tag := range current {
+		existing[tag.TitleModel] = true
+		if !wanted[tag.TitleModel] {
+			removedIDs = append(removedIDs, tag.ID)
+		}
+	}
+
+	if len(removedIDs) > 0 {
+		if err := tx.Where("pin_id = ? AND tag_id IN ?", pinID, removedIDs).Delete(&models.PinTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pin-tag relations: %w", err)
+		}
+		if err := tx.Model(&models.Tag{}).
+			Where("id IN ?", removedIDs).
+			Updates(map[string]interface{}{
+				"count":      gorm.Expr("GREATEST(count - 1, 0)"),
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to decrement tag counts: %w", err)
+		}
+	}
+
+	for title := range wanted {
+		if existing[title] {
+			continue
+		}
+
+		var tag models.Tag
+		result := tx.Where("title_model = ?", title).First(&tag)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			tag = models.Tag{
+				TitleModel: title,
+				TitleEN:    formatModelTagToEnglish(title),
+				Count:      1,
+				CreatedAt:  time.Now(),
+				UpdatedAt:  time.Now(),
+			}
+			if err := tx.Create(&tag).Error; err != nil {
+				return fmt.Errorf("failed to create tag %q: %w", title, err)
+			}
+		} else if result.Error != nil {
+			return fmt.Errorf("failed to fetch tag %q: %w", title, result.Error)
 		} else {
-			// Создаем связи между пином и тегами
-			for _, tagTitle := range tags {
-				var tag models.Tag
-				// Ищем существующий тег
-				result := h.db.Where("title_model = ?", tagTitle).First(&tag)
-				if result.Error == gorm.ErrRecordNotFound {
-					// Если тег не найден, создаем новый
-					tag = models.Tag{
-						TitleModel: tagTitle,
-						TitleEN:    formatModelTagToEnglish(tagTitle),
-						Count:      1,
-						CreatedAt:  time.Now(),
-						UpdatedAt:  time.Now(),
-					}
-					if err := h.db.Create(&tag).Error; err != nil {
-						log.Printf("Failed to create tag: %v", err)
-						continue
-					}
-				} else {
-					// Увеличиваем счетчик существующего тега
-					if err := h.db.Model(&tag).Update("count", tag.Count+1).Error; err != nil {
-						log.Printf("Failed to update tag count: %v", err)
-						continue
-					}
-				}
-
-				// Создаем связь между пином и тегом
-				pinTag := models.PinTag{
-					PinID:     pin.ID,
-					TagID:     tag.ID,
-					CreatedAt: time.Now(),
-				}
-				if err := h.db.Create(&pinTag).Error; err != nil {
-					log.Printf("Failed to create pin-tag relation: %v", err)
-					continue
-				}
-
-				// Добавляем тег в очередь на перевод только после успешного создания связи
-				// if tag.TitleRU == "" {
-				// 	h.taskQueue.AddTranslationTask(tag.ID)
-				// }
+			if err := tx.Model(&tag).Update("count", gorm.Expr("count + 1")).Error; err != nil {
+				return fmt.Errorf("failed to increment tag count: %w", err)
 			}
 		}
+
+		pinTag := models.PinTag{
+			PinID:     pinID,
+			TagID:     tag.ID,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&pinTag).Error; err != nil {
+			return fmt.Errorf("failed to create pin-tag relation: %w", err)
+		}
 	}
 
-	// Index the pin in Elasticsearch
+	return nil
+}
+
+// fetchPinTags возвращает теги, привязанные к пину через pin_tags
+func fetchPinTags(db *gorm.DB, pinID int) ([]models.Tag, error) {
 	var tags []models.Tag
-	if err := h.db.Model(&pin).Association("Tags").Find(&tags); err != nil {
-		log.Printf("Failed to fetch tags for Elasticsearch indexing: %v", err)
-	} else {
-		if err := h.es.IndexPin(r.Context(), pin, tags); err != nil {
-			log.Printf("Failed to index pin in Elasticsearch: %v", err)
+	if err := db.Table("tags").
+		Joins("JOIN pin_tags ON pin_tags.tag_id = tags.id").
+		Where("pin_tags.pin_id = ?", pinID).
+		Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pin tags: %w", err)
+	}
+	return tags, nil
+}
+
+// withMediaURLs подставляет в пины публичные адреса медиафайлов вместо ключей хранилища
+func withMediaURLs(store storage.Storage, pins []models.Pin) []models.Pin {
+	for i := range pins {
+		withMediaURL(store, &pins[i])
+	}
+	return pins
+}
+
+// withMediaURL подставляет публичные адреса в пин и его копии и добавляет в renditions оригинал,
+// чтобы клиент мог собрать srcset из одного массива
+func withMediaURL(store storage.Storage, pin *models.Pin) {
+	for i := range pin.Renditions {
+		pin.Renditions[i].URL = store.URL(pin.Renditions[i].Key)
+	}
+
+	pin.Path = storage.PublicURL(store, pin.Path)
+
+	original := models.PinRendition{Name: media.RenditionOriginal, URL: pin.Path}
+	if pin.Width != nil && pin.Height != nil {
+		original.Width, original.Height = *pin.Width, *pin.Height
+	}
+	pin.Renditions = append(pin.Renditions, original)
+}
+
+// preloadRenditions подгружает копии изображений пинов от меньшей к большей
+func preloadRenditions(db *gorm.DB) *gorm.DB {
+	return db.Preload("Renditions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("width ASC")
+	})
+}
+
+// loadPinsByIDs загружает пины с копиями в порядке ids. Пины, удаленные к моменту запроса, пропускаются
+func loadPinsByIDs(db *gorm.DB, ids []int) ([]models.Pin, error) {
+	var pins []models.Pin
+	if len(ids) > 0 {
+		if err := preloadRenditions(db).Where("id IN ?", ids).Find(&pins).Error; err != nil {
+			return nil, err
 		}
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Pin uploaded successfully", "path": filePath, "id": fmt.Sprintf("%d", pin.ID)})
+	byID := make(map[int]models.Pin, len(pins))
+	for _, pin := range pins {
+		byID[pin.ID] = pin
+	}
+	ordered := make([]models.Pin, 0, len(pins))
+	for _, id := range ids {
+		if pin, ok := byID[id]; ok {
+			ordered = append(ordered, pin)
+		}
+	}
+	return ordered, nil
 }
 
-func (h *PinHandler) SearchPins(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// SearchPinsByImage обрабатывает HTTP POST запрос обратного поиска по изображению.
+// Пины ранжируются по расстоянию Хэмминга между перцептивными хэшами
+func (h *PinHandler) SearchPinsByImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		http.Error(w, "Search query is required", http.StatusBadRequest)
+	if err := r.ParseMultipartForm(10 * 1024 * 1024); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
-	// Получаем все ID пинов, соответствующих поисковому запросу
-	pinIDs, total, err := h.es.SearchPinIDs(r.Context(), query)
+	maxDistance := imageSearchDefaultDistance
+	if distanceStr := r.FormValue("distance"); distanceStr != "" {
+		d, err := strconv.Atoi(distanceStr)
+		if err != nil || d < 0 || d > imageSearchMaxDistance {
+			http.Error(w, fmt.Sprintf("Distance must be between 0 and %d", imageSearchMaxDistance), http.StatusBadRequest)
+			return
+		}
+		maxDistance = d
+	}
+
+	file, _, err := r.FormFile("media")
 	if err != nil {
-		log.Printf("Failed to search pins: %v", err)
+		http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	info, err := media.Inspect(file)
+	if err != nil || (info.Type != media.TypeImage && info.Type != media.TypeGIF) {
+		http.Error(w, "Unsupported media type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := media.HashImage(file)
+	if err != nil {
+		log.Printf("Failed to hash search image: %v", err)
+		http.Error(w, "Invalid media file", http.StatusBadRequest)
+		return
+	}
+
+	matches := h.hashIndex.Search(hash, maxDistance, imageSearchLimit)
+
+	// Индекс мог отстать от базы (пин удален на другой реплике) — loadPinsByIDs пропустит такие пины
+	pins, err := loadPinsByIDs(h.db, matchPinIDs(matches))
+	if err != nil {
+		log.Printf("Failed to fetch image search results: %v", err)
 		http.Error(w, "Failed to perform search", http.StatusInternalServerError)
 		return
 	}
 
 	response := SearchPinsResponse{
-		PinIDs: pinIDs,
-		Total:  total,
+		Pins:     withMediaURLs(h.storage, pins),
+		Total:    len(pins),
+		Strategy: searchStrategyExact,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -432,8 +863,64 @@ func (h *PinHandler) GetPinComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := h.db.Where("pin_id = ?", pinID).Order("created_at DESC, id DESC")
+
+	// Раньше комментарии отдавались без пагинации: клиенты, которые не просят страницу, получают все
+	params := r.URL.Query()
+	if !params.Has("page") && !params.Has("limit") && !params.Has("cursor") {
+		var comments []models.Comment
+		if err := query.Find(&comments).Error; err != nil {
+			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			log.Printf("Failed to fetch comments: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(comments); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	pageReq, err := parsePageRequest(r, maxPageLimit)
+	if err != nil || (pageReq.After != nil && pageReq.After.Time == nil) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	if pageReq.CursorMode {
+		if after := pageReq.After; after != nil {
+			query = query.Where("(created_at, id) < (?, ?)", *after.Time, after.ID)
+		}
+
+		var comments []models.Comment
+		if err := query.Limit(pageReq.Limit + 1).Find(&comments).Error; err != nil {
+			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			log.Printf("Failed to fetch comments: %v", err)
+			return
+		}
+
+		next := nextCursor(len(comments), pageReq.Limit, func(last int) pageCursor {
+			return pageCursor{Time: &comments[last].CreatedAt, ID: comments[last].ID}
+		})
+		if len(comments) > pageReq.Limit {
+			comments = comments[:pageReq.Limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cursorPage{Items: comments, NextCursor: next})
+		return
+	}
+
+	var totalCount int64
+	if err := h.db.Model(&models.Comment{}).Where("pin_id = ?", pinID).Count(&totalCount).Error; err != nil {
+		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+		log.Printf("Failed to count comments: %v", err)
+		return
+	}
+
 	var comments []models.Comment
-	result := h.db.Where("pin_id = ?", pinID).Order("created_at DESC").Find(&comments)
+	result := query.Limit(pageReq.Limit).Offset(pageReq.Offset()).Find(&comments)
 	if result.Error != nil {
 		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
 		log.Printf("Failed to fetch comments: %v", result.Error)
@@ -441,6 +928,7 @@ func (h *PinHandler) GetPinComments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
 	if err := json.NewEncoder(w).Encode(comments); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
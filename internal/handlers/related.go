@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/middleware"
+	"pornterest/internal/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// GetRelatedPins отдает пины, похожие на указанный, страницами по cursor. Авторизованному
+// пользователю не показываются пины заблокированных им авторов
+func (h *PinHandler) GetRelatedPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pinID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pin ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.Select("id").First(&models.Pin{}, pinID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Pin not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to fetch pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch related pins", http.StatusInternalServerError)
+		return
+	}
+
+	limit, _ := parsePageParams(r, 20)
+	req := elasticsearch.RelatedPinsRequest{PinID: pinID, Size: limit}
+
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeSearchCursor(cursorStr)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		req.After = &cursor.SearchAfter
+	}
+
+	// Теги берем из базы, а не из документа индекса: он может отставать от pin_tags
+	if err := h.db.Model(&models.PinTag{}).Where("pin_id = ?", pinID).Pluck("tag_id", &req.TagIDs).Error; err != nil {
+		log.Printf("Failed to fetch tags of pin %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch related pins", http.StatusInternalServerError)
+		return
+	}
+
+	if userID, ok := middleware.UserIDFromContext(r.Context()); ok {
+		if req.ExcludeUserIDs, err = blockedUserIDs(h.db, userID); err != nil {
+			log.Printf("Failed to fetch users blocked by %d: %v", userID, err)
+			http.Error(w, "Failed to fetch related pins", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	page, err := h.es.RelatedPinPage(r.Context(), req)
+	if err != nil {
+		log.Printf("Failed to search pins related to %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch related pins", http.StatusInternalServerError)
+		return
+	}
+
+	pins, err := loadPinsByIDs(h.db, page.IDs)
+	if err != nil {
+		log.Printf("Failed to fetch pins related to %d: %v", pinID, err)
+		http.Error(w, "Failed to fetch related pins", http.StatusInternalServerError)
+		return
+	}
+
+	response := cursorPage{Items: withMediaURLs(h.storage, pins)}
+	if page.Next != nil {
+		next := encodeSearchCursor(&searchCursor{SearchAfter: *page.Next})
+		response.NextCursor = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
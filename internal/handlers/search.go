@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/media"
+	"pornterest/internal/models"
+	"pornterest/internal/searchql"
+
+	"gorm.io/gorm"
+)
+
+// SearchPinsResponse — страница результатов поиска. next_cursor равен null на последней странице
+type SearchPinsResponse struct {
+	Pins       []models.Pin `json:"pins"`
+	Total      int          `json:"total"`
+	NextCursor *string      `json:"next_cursor"`
+	// Facets отдаются только с первой страницей: на следующих они бы не изменились
+	Facets *SearchFacets `json:"facets,omitempty"`
+	// Strategy — exact, если найдено по запросу как есть, или relaxed, если без слов из dropped_terms
+	Strategy     string   `json:"strategy"`
+	DroppedTerms []string `json:"dropped_terms,omitempty"`
+	// Suggestions — исправления опечаток, если по исходному запросу ничего не нашлось
+	Suggestions []elasticsearch.PhraseSuggestion `json:"suggestions,omitempty"`
+	// Highlights — почему пины совпали, по id пина
+	Highlights map[int]SearchHighlight `json:"highlights,omitempty"`
+}
+
+// SearchHighlight — совпадения запроса в пине. Фрагменты экранированы как HTML, совпадения обернуты в <em>
+type SearchHighlight struct {
+	// Fields — фрагменты по полям: title, description, original_file_name, tags.title_en, tags.title_ru
+	Fields      map[string][]string         `json:"fields,omitempty"`
+	MatchedTags []elasticsearch.TagDocument `json:"matched_tags,omitempty"`
+}
+
+// Стратегии, которыми получена выдача поиска
+const (
+	searchStrategyExact   = "exact"
+	searchStrategyRelaxed = "relaxed"
+)
+
+// maxRelaxAttempts — сколько ослабленных вариантов запроса пробуется, если по исходному ничего не нашлось
+const maxRelaxAttempts = 3
+
+// SearchFacets — агрегации выдачи для боковой панели фильтров
+type SearchFacets struct {
+	Types map[string]int `json:"types"`
+	AI    AIFacet        `json:"ai"`
+	Tags  []TagFacet     `json:"tags"`
+}
+
+// AIFacet — число пинов, сгенерированных и не сгенерированных нейросетью
+type AIFacet struct {
+	AI    int `json:"ai"`
+	NonAI int `json:"non_ai"`
+}
+
+// TagFacet — тег и число пинов выдачи с ним
+type TagFacet struct {
+	Tag   models.Tag `json:"tag"`
+	Count int        `json:"count"`
+}
+
+// SearchPins ищет пины по запросу и фильтрам и отдает страницу пинов. Синтаксис q описан в пакете searchql.
+// Фильтры: type (через запятую), ai, author (никнейм), from/to (YYYY-MM-DD или RFC 3339),
+// min_width/max_width/min_height/max_height, orientation, min_duration/max_duration, color.
+// sort: relevance, new, likes, saves или trending
+func (h *PinHandler) SearchPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+
+	query, err := searchql.Parse(params.Get("q"))
+	if err != nil {
+		writeQuerySyntaxError(w, err)
+		return
+	}
+
+	// Параметр sort важнее sort: в тексте запроса
+	sort := query.Sort
+	if sortParam := params.Get("sort"); sortParam != "" {
+		if !slices.Contains(searchql.SortValues, sortParam) {
+			http.Error(w, "Invalid sort, expected one of: "+strings.Join(searchql.SortValues, ", "), http.StatusBadRequest)
+			return
+		}
+		sort = sortParam
+	}
+
+	filters, err := parseSearchFilters(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if author := params.Get("author"); author != "" {
+		var user models.User
+		if err := h.db.Select("id").Where("nickname = ?", author).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Пинов несуществующего автора нет — пустая выдача, а не ошибка
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(SearchPinsResponse{Pins: []models.Pin{}, Strategy: searchStrategyExact})
+				return
+			}
+			log.Printf("Failed to find author %q: %v", author, err)
+			http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+			return
+		}
+		filters.UserID = &user.ID
+	}
+
+	if query.Root == nil && filters.IsEmpty() {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.resolveNicknames(query.Users())
+	if err != nil {
+		log.Printf("Failed to resolve query users: %v", err)
+		http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+		return
+	}
+
+	size := 20
+	if sizeStr := params.Get("size"); sizeStr != "" {
+		s, err := strconv.Atoi(sizeStr)
+		if err != nil || s <= 0 {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+		size = min(s, maxPageLimit)
+	}
+
+	// Курсор привязан к снимку индекса, но не к запросу: q и фильтры клиент передает те же, что и для первой страницы.
+	// Если первая страница была найдена ослабленным запросом, курсор помнит отброшенные слова
+	var cursor *searchCursor
+	if cursorStr := params.Get("cursor"); cursorStr != "" {
+		decoded, err := decodeSearchCursor(cursorStr)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = decoded
+	}
+
+	req := elasticsearch.PinSearchRequest{
+		Query:   query,
+		Users:   users,
+		Filters: filters,
+		Sort:    sort,
+		Size:    size,
+		Facets:  cursor == nil,
+	}
+	strategy := searchStrategyExact
+	var dropped []string
+	if cursor != nil {
+		req.After = &cursor.SearchAfter
+		if len(cursor.Dropped) > 0 {
+			req.Query = query.WithoutWords(cursor.Dropped)
+			strategy = searchStrategyRelaxed
+			dropped = cursor.Dropped
+		}
+	}
+
+	page, err := h.es.SearchPinPage(r.Context(), req)
+	if errors.Is(err, elasticsearch.ErrSearchExpired) {
+		http.Error(w, "Search cursor expired, restart the search", http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to search pins: %v", err)
+		http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+		return
+	}
+
+	// Пустая первая страница: предлагаем исправления и пробуем найти хоть что-то без самых редких слов
+	var suggestions []elasticsearch.PhraseSuggestion
+	if cursor == nil && page.Total == 0 {
+		if words := query.Words(); len(words) > 0 {
+			suggestions, err = h.es.SuggestPhrases(r.Context(), strings.Join(words, " "))
+			if err != nil {
+				log.Printf("Failed to suggest search phrases: %v", err)
+			}
+
+			relaxedPage, relaxedDropped, err := h.relaxSearch(r.Context(), req, words)
+			if err != nil {
+				log.Printf("Failed to relax search query: %v", err)
+			} else if relaxedPage != nil {
+				page = relaxedPage
+				strategy = searchStrategyRelaxed
+				dropped = relaxedDropped
+			}
+		}
+	}
+
+	pins, err := loadPinsByIDs(h.db, page.IDs)
+	if err != nil {
+		log.Printf("Failed to fetch found pins: %v", err)
+		http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+		return
+	}
+
+	response := SearchPinsResponse{
+		Pins:         withMediaURLs(h.storage, pins),
+		Total:        page.Total,
+		Strategy:     strategy,
+		DroppedTerms: dropped,
+		Suggestions:  suggestions,
+	}
+	if len(page.Highlights) > 0 {
+		response.Highlights = make(map[int]SearchHighlight, len(page.Highlights))
+		for id, highlight := range page.Highlights {
+			response.Highlights[id] = SearchHighlight{Fields: highlight.Fields, MatchedTags: highlight.Tags}
+		}
+	}
+	if page.Next != nil {
+		next := encodeSearchCursor(&searchCursor{SearchAfter: *page.Next, Dropped: dropped})
+		response.NextCursor = &next
+	}
+	if page.Facets != nil {
+		facets, err := h.searchFacets(page.Facets)
+		if err != nil {
+			log.Printf("Failed to load facet tags: %v", err)
+			http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+			return
+		}
+		response.Facets = facets
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// relaxSearch ищет по запросу без самых редких слов: слова упорядочиваются по числу пинов, в которых
+// встречаются, и отбрасываются с конца, пока что-нибудь не найдется. Хотя бы одно слово остается.
+// Возвращает nil, если ни один вариант ничего не нашел
+func (h *PinHandler) relaxSearch(ctx context.Context, req elasticsearch.PinSearchRequest, words []string) (*elasticsearch.PinSearchPage, []string, error) {
+	if len(words) < 2 {
+		return nil, nil, nil
+	}
+
+	freq, err := h.es.WordDocFrequencies(ctx, words)
+	if err != nil {
+		return nil, nil, err
+	}
+	ranked := slices.Clone(words)
+	slices.SortStableFunc(ranked, func(a, b string) int {
+		return freq[b] - freq[a]
+	})
+
+	query := req.Query
+	for keep := len(ranked) - 1; keep >= 1 && keep >= len(ranked)-maxRelaxAttempts; keep-- {
+		// Если даже самое частое из оставшихся слов нигде не встречается, искать бессмысленно
+		if freq[ranked[0]] == 0 {
+			break
+		}
+		dropped := ranked[keep:]
+		req.Query = query.WithoutWords(dropped)
+		page, err := h.es.SearchPinPage(ctx, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if page.Total > 0 {
+			return page, dropped, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// QuerySyntaxErrorResponse — ошибка в запросе q. position — номер символа с единицы
+type QuerySyntaxErrorResponse struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+}
+
+// writeQuerySyntaxError отвечает 400 с описанием ошибки разбора и ее позицией
+func writeQuerySyntaxError(w http.ResponseWriter, err error) {
+	var syntaxErr *searchql.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(QuerySyntaxErrorResponse{
+		Message:  syntaxErr.Error(),
+		Position: syntaxErr.Pos + 1,
+	})
+}
+
+// resolveNicknames находит id пользователей по никнеймам из user:. Несуществующие никнеймы в ответ не попадают
+func (h *PinHandler) resolveNicknames(nicknames []string) (map[string]int, error) {
+	users := make(map[string]int, len(nicknames))
+	if len(nicknames) == 0 {
+		return users, nil
+	}
+
+	var found []models.User
+	if err := h.db.Select("id", "nickname").Where("nickname IN ?", nicknames).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range found {
+		users[user.Nickname] = user.ID
+	}
+	return users, nil
+}
+
+// searchFacets дополняет агрегации индекса тегами из базы
+func (h *PinHandler) searchFacets(agg *elasticsearch.PinFacets) (*SearchFacets, error) {
+	facets := &SearchFacets{
+		Types: agg.Types,
+		AI:    AIFacet{AI: agg.AI, NonAI: agg.NonAI},
+		Tags:  make([]TagFacet, 0, len(agg.Tags)),
+	}
+	if len(agg.Tags) == 0 {
+		return facets, nil
+	}
+
+	ids := make([]int, len(agg.Tags))
+	for i, bucket := range agg.Tags {
+		ids[i] = bucket.TagID
+	}
+	var tags []models.Tag
+	if err := h.db.Where("id IN ?", ids).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Tag, len(tags))
+	for _, tag := range tags {
+		byID[tag.ID] = tag
+	}
+
+	for _, bucket := range agg.Tags {
+		if tag, ok := byID[bucket.TagID]; ok {
+			facets.Tags = append(facets.Tags, TagFacet{Tag: tag, Count: bucket.Count})
+		}
+	}
+	return facets, nil
+}
+
+// parseSearchFilters разбирает фильтры поиска из строки запроса. Автор разрешается отдельно — нужен запрос в базу
+func parseSearchFilters(params url.Values) (elasticsearch.PinSearchFilters, error) {
+	var filters elasticsearch.PinSearchFilters
+
+	// color=#rrggbb оставляет пины, в палитре которых есть близкий по восприятию цвет
+	if colorStr := params.Get("color"); colorStr != "" {
+		color, err := media.HexToLab(colorStr)
+		if err != nil {
+			return filters, errors.New("Invalid color, expected #rrggbb")
+		}
+		filters.Color = &color
+	}
+
+	if typesStr := params.Get("type"); typesStr != "" {
+		for _, t := range strings.Split(typesStr, ",") {
+			t = strings.TrimSpace(t)
+			if t != media.TypeImage && t != media.TypeGIF && t != media.TypeVideo {
+				return filters, fmt.Errorf("Invalid type %q, expected image, gif or video", t)
+			}
+			filters.Types = append(filters.Types, t)
+		}
+	}
+
+	if aiStr := params.Get("ai"); aiStr != "" {
+		ai, err := strconv.ParseBool(aiStr)
+		if err != nil {
+			return filters, errors.New("Invalid ai, expected true or false")
+		}
+		filters.AI = &ai
+	}
+
+	if orientation := params.Get("orientation"); orientation != "" {
+		switch orientation {
+		case elasticsearch.OrientationLandscape, elasticsearch.OrientationPortrait, elasticsearch.OrientationSquare:
+			filters.Orientation = orientation
+		default:
+			return filters, errors.New("Invalid orientation, expected landscape, portrait or square")
+		}
+	}
+
+	var err error
+	if filters.CreatedFrom, err = parseSearchDate(params, "from", false); err != nil {
+		return filters, err
+	}
+	if filters.CreatedTo, err = parseSearchDate(params, "to", true); err != nil {
+		return filters, err
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{
+		{"min_width", &filters.MinWidth},
+		{"max_width", &filters.MaxWidth},
+		{"min_height", &filters.MinHeight},
+		{"max_height", &filters.MaxHeight},
+	} {
+		if v := params.Get(bound.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filters, fmt.Errorf("Invalid %s", bound.name)
+			}
+			*bound.dst = &n
+		}
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **float64
+	}{
+		{"min_duration", &filters.MinDuration},
+		{"max_duration", &filters.MaxDuration},
+	} {
+		if v := params.Get(bound.name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				return filters, fmt.Errorf("Invalid %s", bound.name)
+			}
+			*bound.dst = &n
+		}
+	}
+
+	return filters, nil
+}
+
+// parseSearchDate разбирает дату в формате YYYY-MM-DD или RFC 3339.
+// Для верхней границы дата без времени означает конец этого дня
+func parseSearchDate(params url.Values, name string, upper bool) (*time.Time, error) {
+	v := params.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s, expected YYYY-MM-DD", name)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// searchCursor — позиция в выдаче и слова, отброшенные при ослаблении запроса на первой странице
+type searchCursor struct {
+	elasticsearch.SearchAfter
+	Dropped []string `json:"dropped,omitempty"`
+}
+
+func encodeSearchCursor(c *searchCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSearchCursor(s string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c searchCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.PIT == "" || len(c.Sort) == 0 {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
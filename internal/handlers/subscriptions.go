@@ -8,21 +8,24 @@ import (
 	"strconv"
 	"time"
 
+	"pornterest/internal/feed"
 	"pornterest/internal/middleware"
 	"pornterest/internal/models"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SubscriptionHandler обрабатывает запросы, связанные с подписками пользователей
 type SubscriptionHandler struct {
-	db *gorm.DB
+	db   *gorm.DB
+	feed *feed.Service
 }
 
 // NewSubscriptionHandler создает новый экземпляр SubscriptionHandler
-func NewSubscriptionHandler(db *gorm.DB) *SubscriptionHandler {
-	return &SubscriptionHandler{db: db}
+func NewSubscriptionHandler(db *gorm.DB, timelines *feed.Service) *SubscriptionHandler {
+	return &SubscriptionHandler{db: db, feed: timelines}
 }
 
 // SubscribeUser обрабатывает HTTP POST запрос для подписки одного пользователя на другого
@@ -57,12 +60,13 @@ func (h *SubscriptionHandler) SubscribeUser(w http.ResponseWriter, r *http.Reque
 		CreatedAt:    time.Now(),
 	}
 
-	result := h.db.Create(&subscription)
+	result := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&subscription)
 	if result.Error != nil {
 		log.Printf("Failed to subscribe user %d to %d: %v", userID, targetUserID, result.Error)
 		http.Error(w, "Failed to subscribe", http.StatusInternalServerError)
 		return
 	}
+	invalidateFeed(h.feed, userID)
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Subscribed successfully"})
@@ -99,6 +103,7 @@ func (h *SubscriptionHandler) UnsubscribeUser(w http.ResponseWriter, r *http.Req
 		http.Error(w, "Subscription not found", http.StatusNotFound)
 		return
 	}
+	invalidateFeed(h.feed, userID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Unsubscribed successfully"})
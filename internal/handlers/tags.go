@@ -9,17 +9,26 @@ import (
 	"strings"
 	"time"
 
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/feed"
+	"pornterest/internal/middleware"
 	"pornterest/internal/models"
+	"pornterest/internal/outbox"
+	"pornterest/internal/tagsuggest"
 
+	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TagHandler struct {
-	db *gorm.DB
+	db   *gorm.DB
+	es   *elasticsearch.ESClient
+	feed *feed.Service
 }
 
-func NewTagHandler(db *gorm.DB) *TagHandler {
-	return &TagHandler{db: db}
+func NewTagHandler(db *gorm.DB, es *elasticsearch.ESClient, timelines *feed.Service) *TagHandler {
+	return &TagHandler{db: db, es: es, feed: timelines}
 }
 
 type ProcessTagsRequest struct {
@@ -113,6 +122,8 @@ type GetTagsResponse struct {
 	Total int64        `json:"total"`
 	Page  int          `json:"page"`
 	Limit int          `json:"limit"`
+	// NextCursor заполняется только в режиме курсора; null на последней странице
+	NextCursor *string `json:"next_cursor,omitempty"`
 }
 
 // GetAllTags возвращает все теги с пагинацией
@@ -122,23 +133,10 @@ func (h *TagHandler) GetAllTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	pageStr := r.URL.Query().Get("page")
-
-	limit := 20 // Значение по умолчанию
-	if limitStr != "" {
-		l, err := strconv.Atoi(limitStr)
-		if err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	page := 1 // Значение по умолчанию
-	if pageStr != "" {
-		p, err := strconv.Atoi(pageStr)
-		if err == nil && p > 0 {
-			page = p
-		}
+	pageReq, err := parsePageRequest(r, 20)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
 	var tags []models.Tag
@@ -150,22 +148,37 @@ func (h *TagHandler) GetAllTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.
-		Limit(limit).
-		Offset((page - 1) * limit).
-		Order("count DESC").
-		Find(&tags).Error; err != nil {
+	// id — второй ключ сортировки: у многих тегов одинаковый count, без него порядок нестабилен
+	query := h.db.Order("count DESC, id DESC")
+	if pageReq.CursorMode {
+		if after := pageReq.After; after != nil {
+			query = query.Where("(count, id) < (?, ?)", after.Value, after.ID)
+		}
+		query = query.Limit(pageReq.Limit + 1)
+	} else {
+		query = query.Limit(pageReq.Limit).Offset(pageReq.Offset())
+	}
+
+	if err := query.Find(&tags).Error; err != nil {
 		log.Printf("Failed to fetch tags: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	response := GetTagsResponse{
-		Tags:  tags,
 		Total: total,
-		Page:  page,
-		Limit: limit,
+		Page:  pageReq.Page,
+		Limit: pageReq.Limit,
 	}
+	if pageReq.CursorMode {
+		response.NextCursor = nextCursor(len(tags), pageReq.Limit, func(last int) pageCursor {
+			return pageCursor{Value: int64(tags[last].Count), ID: tags[last].ID}
+		})
+		if len(tags) > pageReq.Limit {
+			tags = tags[:pageReq.Limit]
+		}
+	}
+	response.Tags = tags
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -195,19 +208,33 @@ func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := h.db.Model(&models.Tag{}).
-		Where("id = ?", tagID).
-		Updates(map[string]interface{}{
-			"title_ru":   req.TitleRu,
-			"updated_at": time.Now(),
-		})
+	// Подсказки подхватят новое название по updated_at, документы пинов с тегом переиндексирует outbox
+	var rowsAffected int64
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Tag{}).
+			Where("id = ?", tagID).
+			Updates(map[string]interface{}{
+				"title_ru":   req.TitleRu,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		if rowsAffected == 0 {
+			return nil
+		}
+		id, _ := strconv.Atoi(tagID)
+		return outbox.EnqueueTagPins(tx, id)
+	})
 
-	if result.Error != nil {
+	if err != nil {
+		log.Printf("Failed to update tag %s: %v", tagID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if result.RowsAffected == 0 {
+	if rowsAffected == 0 {
 		http.Error(w, "Tag not found", http.StatusNotFound)
 		return
 	}
@@ -218,6 +245,37 @@ func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+type SuggestTagsResponse struct {
+	Tags []elasticsearch.TagSuggestDocument `json:"tags"`
+}
+
+// SuggestTags подсказывает теги по началу названия на любом языке. Учитывает опечатки
+// и запрос, набранный в неверной раскладке ("rjirf" находит "кошка")
+func (h *TagHandler) SuggestTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, _ := parsePageParams(r, 10)
+
+	tags, err := h.es.SuggestTags(r.Context(), tagsuggest.Variants(query), limit)
+	if err != nil {
+		log.Printf("Failed to suggest tags: %v", err)
+		http.Error(w, "Failed to suggest tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SuggestTagsResponse{Tags: tags})
+}
+
 func (h *TagHandler) SearchTags(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -274,3 +332,74 @@ func formatModelTagToEnglish(modelTag string) string {
 
 	return strings.Join(words, " ")
 }
+
+// SubscribeTag подписывает текущего пользователя на тег: пины с ним попадут в домашнюю ленту
+func (h *TagHandler) SubscribeTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var count int64
+	if err := h.db.Model(&models.Tag{}).Where("id = ?", tagID).Count(&count).Error; err != nil {
+		log.Printf("Failed to check tag %d: %v", tagID, err)
+		http.Error(w, "Failed to subscribe", http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	subscription := models.TagSubscription{
+		UserID:    userID,
+		TagID:     tagID,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&subscription).Error; err != nil {
+		log.Printf("Failed to subscribe user %d to tag %d: %v", userID, tagID, err)
+		http.Error(w, "Failed to subscribe", http.StatusInternalServerError)
+		return
+	}
+	invalidateFeed(h.feed, userID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Subscribed successfully"})
+}
+
+// UnsubscribeTag отписывает текущего пользователя от тега
+func (h *TagHandler) UnsubscribeTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	result := h.db.Where("user_id = ? AND tag_id = ?", userID, tagID).Delete(&models.TagSubscription{})
+	if result.Error != nil {
+		log.Printf("Failed to unsubscribe user %d from tag %d: %v", userID, tagID, result.Error)
+		http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	invalidateFeed(h.feed, userID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unsubscribed successfully"})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pornterest/internal/middleware"
+	"pornterest/internal/models"
+	"pornterest/internal/uploads"
+
+	"github.com/gorilla/mux"
+)
+
+// Версия протокола tus и поддерживаемые расширения
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+// ResumableUploadHandler реализует протокол tus (https://tus.io) для загрузки больших файлов частями.
+// Поля пина передаются в Upload-Metadata под теми же именами, что и в обычной загрузке:
+// filename, title, description, link, allowComments, isAiGenerated, tags
+type ResumableUploadHandler struct {
+	uploads *uploads.Store
+	pins    *PinHandler
+}
+
+func NewResumableUploadHandler(store *uploads.Store, pins *PinHandler) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		uploads: store,
+		pins:    pins,
+	}
+}
+
+// Options сообщает клиенту версию протокола и ограничения сервера
+func (h *ResumableUploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(uploads.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload обрабатывает HTTP POST запрос на создание загрузки
+func (h *ResumableUploadHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Deferred upload length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > uploads.MaxSize {
+		http.Error(w, "Upload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.uploads.Create(userID, length, metadata)
+	if err != nil {
+		log.Printf("Failed to create upload: %v", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUploadOffset обрабатывает HTTP HEAD запрос: сколько байт загрузки уже принято
+func (h *ResumableUploadHandler) GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	upload, ok := h.loadOwnUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload обрабатывает HTTP PATCH запрос с очередным фрагментом файла.
+// Когда получен последний байт, из загрузки создается пин
+func (h *ResumableUploadHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	unlock, err := h.uploads.Lock(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Failed to lock upload: %v", err)
+		http.Error(w, "Failed to lock upload", http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+
+	upload, ok := h.loadOwnUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if upload.PinID == nil {
+		if err := h.uploads.Append(upload, offset, r.Body); err != nil {
+			if errors.Is(err, uploads.ErrOffsetMismatch) {
+				http.Error(w, "Upload-Offset does not match current offset", http.StatusConflict)
+				return
+			}
+			// Принятая часть сохранена, клиент узнает смещение через HEAD и продолжит
+			log.Printf("Failed to append to upload %s: %v", upload.ID, err)
+			http.Error(w, "Failed to save upload chunk", http.StatusInternalServerError)
+			return
+		}
+	} else if offset != upload.Offset {
+		http.Error(w, "Upload-Offset does not match current offset", http.StatusConflict)
+		return
+	}
+
+	// Пустой PATCH после получения всех данных повторяет создание пина, если в прошлый раз оно не удалось
+	if upload.Offset == upload.Length && upload.PinID == nil {
+		if uploadErr := h.completeUpload(r, upload); uploadErr != nil {
+			writeUploadError(w, uploadErr)
+			return
+		}
+	}
+
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUpload обрабатывает HTTP DELETE запрос на отмену загрузки
+func (h *ResumableUploadHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	unlock, err := h.uploads.Lock(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Failed to lock upload: %v", err)
+		http.Error(w, "Failed to lock upload", http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+
+	upload, ok := h.loadOwnUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.uploads.Delete(upload); err != nil {
+		log.Printf("Failed to delete upload %s: %v", upload.ID, err)
+		http.Error(w, "Failed to delete upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUpload передает собранный файл в обычный процесс создания пина.
+// Если файл отклонен, загрузка удаляется; при внутренней ошибке остается, чтобы клиент мог повторить
+func (h *ResumableUploadHandler) completeUpload(r *http.Request, upload *models.Upload) *uploadError {
+	file, err := h.uploads.Open(upload)
+	if err != nil {
+		log.Printf("Failed to open upload %s: %v", upload.ID, err)
+		return &uploadError{Status: http.StatusInternalServerError, Message: "Failed to save file"}
+	}
+	defer file.Close()
+
+	meta := upload.Metadata
+	pin, uploadErr := h.pins.createPin(r.Context(), upload.UserID, pinUpload{
+		Title:         meta["title"],
+		Description:   meta["description"],
+		Link:          meta["link"],
+		AllowComments: strings.ToLower(meta["allowComments"]) == "true",
+		IsAiGenerated: strings.ToLower(meta["isAiGenerated"]) == "true",
+		Tags:          meta["tags"],
+		FileName:      meta["filename"],
+		File:          file,
+		Size:          upload.Length,
+	})
+	if uploadErr != nil {
+		if uploadErr.Status < http.StatusInternalServerError {
+			if err := h.uploads.Delete(upload); err != nil {
+				log.Printf("Failed to delete rejected upload %s: %v", upload.ID, err)
+			}
+		}
+		return uploadErr
+	}
+
+	if err := h.uploads.Complete(upload, pin.ID); err != nil {
+		log.Printf("Failed to complete upload %s: %v", upload.ID, err)
+	}
+	return nil
+}
+
+// loadOwnUpload загружает загрузку из URL и проверяет, что она принадлежит текущему пользователю.
+// Чужие загрузки не раскрываются и выглядят как несуществующие
+func (h *ResumableUploadHandler) loadOwnUpload(w http.ResponseWriter, r *http.Request) (*models.Upload, bool) {
+	userID := r.Context().Value(middleware.UserID).(int)
+
+	upload, err := h.uploads.Get(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, uploads.ErrNotFound) {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Failed to fetch upload: %v", err)
+		http.Error(w, "Failed to fetch upload", http.StatusInternalServerError)
+		return nil, false
+	}
+	if upload.UserID != userID {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if upload.PinID == nil && upload.ExpiresAt.Before(time.Now()) {
+		http.Error(w, "Upload has expired", http.StatusGone)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// checkTusVersion проверяет заголовок Tus-Resumable и добавляет его в ответ
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// writeUploadHeaders отправляет текущее состояние загрузки; после создания пина — и его ID
+func writeUploadHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.PinID != nil {
+		w.Header().Set("Pin-Id", strconv.Itoa(*upload.PinID))
+	} else {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata разбирает Upload-Metadata: пары "ключ значение-в-base64" через запятую
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, errors.New("malformed metadata pair")
+		}
+	}
+	return metadata, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"pornterest/internal/config" // Импортируем пакет config
 	"pornterest/internal/models"
+	"pornterest/internal/storage"
 
 	"github.com/golang-jwt/jwt/v5" // Импортируем библиотеку JWT
 	"github.com/gorilla/mux"
@@ -20,13 +21,14 @@ import (
 
 // UserHandler обрабатывает запросы, связанные с пользователями
 type UserHandler struct {
-	db     *gorm.DB
-	config config.Config // Добавляем поле для хранения конфигурации
+	db      *gorm.DB
+	config  config.Config // Добавляем поле для хранения конфигурации
+	storage storage.Storage
 }
 
 // NewUserHandler создает новый экземпляр UserHandler, принимая конфигурацию
-func NewUserHandler(db *gorm.DB, cfg config.Config) *UserHandler {
-	return &UserHandler{db: db, config: cfg}
+func NewUserHandler(db *gorm.DB, cfg config.Config, store storage.Storage) *UserHandler {
+	return &UserHandler{db: db, config: cfg, storage: store}
 }
 
 // Register обрабатывает HTTP POST запрос для регистрации нового пользователя
@@ -49,6 +51,9 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Права модератора через регистрацию не выдаются
+	user.Admin = false
+
 	// Хеширование пароля
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -438,27 +443,12 @@ func (h *UserHandler) GetUserPinsByUsername(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	pageStr := r.URL.Query().Get("page")
-
-	limit := 20 // Значение по умолчанию
-	if limitStr != "" {
-		l, err := strconv.Atoi(limitStr)
-		if err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	page := 1 // Значение по умолчанию
-	if pageStr != "" {
-		p, err := strconv.Atoi(pageStr)
-		if err == nil && p > 0 {
-			page = p
-		}
+	pageReq, err := parsePageRequest(r, 20)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
-	offset := (page - 1) * limit
-
 	var user models.User
 	result := h.db.Where("nickname = ?", username).First(&user)
 	if result.Error != nil {
@@ -471,20 +461,46 @@ func (h *UserHandler) GetUserPinsByUsername(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	var totalCount int64
+	h.db.Model(&models.Pin{}).Where("user_id = ?", user.ID).Count(&totalCount)
+
+	if pageReq.CursorMode {
+		query := preloadRenditions(h.db).Where("user_id = ?", user.ID)
+		if pageReq.After != nil {
+			query = query.Where("id < ?", pageReq.After.ID)
+		}
+
+		var pins []models.Pin
+		if err := query.Limit(pageReq.Limit + 1).Order("id DESC").Find(&pins).Error; err != nil {
+			log.Printf("Failed to get user pins: %v", err)
+			http.Error(w, "Failed to fetch user pins", http.StatusInternalServerError)
+			return
+		}
+
+		next := nextCursor(len(pins), pageReq.Limit, func(last int) pageCursor {
+			return pageCursor{ID: pins[last].ID}
+		})
+		if len(pins) > pageReq.Limit {
+			pins = pins[:pageReq.Limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
+		json.NewEncoder(w).Encode(cursorPage{Items: withMediaURLs(h.storage, pins), NextCursor: next})
+		return
+	}
+
 	var pins []models.Pin
-	pinsResult := h.db.Where("user_id = ?", user.ID).Limit(limit).Offset(offset).Order("id DESC").Find(&pins)
+	pinsResult := preloadRenditions(h.db).Where("user_id = ?", user.ID).Limit(pageReq.Limit).Offset(pageReq.Offset()).Order("id DESC").Find(&pins)
 	if pinsResult.Error != nil {
 		log.Printf("Failed to get user pins: %v", pinsResult.Error)
 		http.Error(w, "Failed to fetch user pins", http.StatusInternalServerError)
 		return
 	}
 
-	var totalCount int64
-	h.db.Model(&models.Pin{}).Where("user_id = ?", user.ID).Count(&totalCount)
-
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
-	if err := json.NewEncoder(w).Encode(pins); err != nil {
+	if err := json.NewEncoder(w).Encode(withMediaURLs(h.storage, pins)); err != nil {
 		log.Printf("Failed to encode response: %v", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
@@ -505,27 +521,12 @@ func (h *UserHandler) GetUserSavedPinsByUsername(w http.ResponseWriter, r *http.
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	pageStr := r.URL.Query().Get("page")
-
-	limit := 20 // Значение по умолчанию
-	if limitStr != "" {
-		l, err := strconv.Atoi(limitStr)
-		if err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	page := 1 // Значение по умолчанию
-	if pageStr != "" {
-		p, err := strconv.Atoi(pageStr)
-		if err == nil && p > 0 {
-			page = p
-		}
+	pageReq, err := parsePageRequest(r, 20)
+	if err != nil || (pageReq.After != nil && pageReq.After.Time == nil) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
-	offset := (page - 1) * limit
-
 	var user models.User
 	result := h.db.Where("nickname = ?", username).First(&user)
 	if result.Error != nil {
@@ -538,11 +539,53 @@ func (h *UserHandler) GetUserSavedPinsByUsername(w http.ResponseWriter, r *http.
 		return
 	}
 
+	var totalCount int64
+	h.db.Model(&models.UserAction{}).Where("user_id = ? AND action = ?", user.ID, "save").Count(&totalCount)
+
+	if pageReq.CursorMode {
+		// Курсор — время и id сохранения, а не пина: порядок задает момент сохранения
+		query := h.db.Where("user_id = ? AND action = ?", user.ID, "save")
+		if after := pageReq.After; after != nil {
+			query = query.Where("(created_at, id) < (?, ?)", *after.Time, after.ID)
+		}
+
+		var actions []models.UserAction
+		if err := query.Order("created_at DESC, id DESC").Limit(pageReq.Limit + 1).Find(&actions).Error; err != nil {
+			log.Printf("Failed to get user saved pins: %v", err)
+			http.Error(w, "Failed to fetch user saved pins", http.StatusInternalServerError)
+			return
+		}
+
+		next := nextCursor(len(actions), pageReq.Limit, func(last int) pageCursor {
+			return pageCursor{Time: &actions[last].CreatedAt, ID: actions[last].ID}
+		})
+		if len(actions) > pageReq.Limit {
+			actions = actions[:pageReq.Limit]
+		}
+
+		pinIDs := make([]int, len(actions))
+		for i, action := range actions {
+			pinIDs[i] = action.PinID
+		}
+
+		savedPins, err := loadPinsByIDs(h.db, pinIDs)
+		if err != nil {
+			log.Printf("Failed to get user saved pins: %v", err)
+			http.Error(w, "Failed to fetch user saved pins", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
+		json.NewEncoder(w).Encode(cursorPage{Items: withMediaURLs(h.storage, savedPins), NextCursor: next})
+		return
+	}
+
 	var savedPins []models.Pin
-	savedPinsResult := h.db.Joins("JOIN user_actions ON user_actions.pin_id = pins.id").
+	savedPinsResult := preloadRenditions(h.db).Joins("JOIN user_actions ON user_actions.pin_id = pins.id").
 		Where("user_actions.user_id = ? AND user_actions.action = ?", user.ID, "save").
-		Limit(limit).
-		Offset(offset).
+		Limit(pageReq.Limit).
+		Offset(pageReq.Offset()).
 		Order("user_actions.created_at DESC").
 		Find(&savedPins)
 	if savedPinsResult.Error != nil {
@@ -551,12 +594,9 @@ func (h *UserHandler) GetUserSavedPinsByUsername(w http.ResponseWriter, r *http.
 		return
 	}
 
-	var totalCount int64
-	h.db.Model(&models.UserAction{}).Where("user_id = ? AND action = ?", user.ID, "save").Count(&totalCount)
-
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Total-Count", strconv.Itoa(int(totalCount)))
-	if err := json.NewEncoder(w).Encode(savedPins); err != nil {
+	if err := json.NewEncoder(w).Encode(withMediaURLs(h.storage, savedPins)); err != nil {
 		log.Printf("Failed to encode response: %v", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
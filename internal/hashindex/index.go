@@ -0,0 +1,170 @@
+package hashindex
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Match — найденный пин и расстояние Хэмминга от его хэша до искомого
+type Match struct {
+	PinID    int
+	Distance int
+}
+
+// node — узел BK-дерева. Пины с одинаковым хэшем делят один узел
+type node struct {
+	hash     uint64
+	pinIDs   []int
+	children map[int]*node
+}
+
+// Index — BK-дерево перцептивных хэшей в памяти процесса. Поиск всех хэшей в радиусе d
+// отсекает поддеревья по неравенству треугольника и не перебирает все пины
+type Index struct {
+	mu     sync.RWMutex
+	root   *node
+	hashes map[int]uint64
+	// syncedUntil — наибольший created_at, загруженный из базы. Add его не двигает:
+	// пин, добавленный локально, не означает, что загружены все пины до него
+	syncedUntil time.Time
+}
+
+// New создает пустой индекс
+func New() *Index {
+	return &Index{hashes: make(map[int]uint64)}
+}
+
+// Add добавляет или обновляет хэш пина
+func (idx *Index) Add(pinID int, hash uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.hashes[pinID]; ok {
+		if old == hash {
+			return
+		}
+		idx.removeLocked(pinID, old)
+	}
+	idx.hashes[pinID] = hash
+
+	if idx.root == nil {
+		idx.root = &node{hash: hash, pinIDs: []int{pinID}}
+		return
+	}
+
+	current := idx.root
+	for {
+		d := distance(current.hash, hash)
+		if d == 0 {
+			current.pinIDs = append(current.pinIDs, pinID)
+			return
+		}
+		child, ok := current.children[d]
+		if !ok {
+			if current.children == nil {
+				current.children = make(map[int]*node)
+			}
+			current.children[d] = &node{hash: hash, pinIDs: []int{pinID}}
+			return
+		}
+		current = child
+	}
+}
+
+// Remove удаляет пин из индекса. Узел остается в дереве, чтобы не перестраивать поддерево
+func (idx *Index) Remove(pinID int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if hash, ok := idx.hashes[pinID]; ok {
+		idx.removeLocked(pinID, hash)
+		delete(idx.hashes, pinID)
+	}
+}
+
+func (idx *Index) removeLocked(pinID int, hash uint64) {
+	current := idx.root
+	for current != nil {
+		d := distance(current.hash, hash)
+		if d == 0 {
+			for i, id := range current.pinIDs {
+				if id == pinID {
+					current.pinIDs = append(current.pinIDs[:i], current.pinIDs[i+1:]...)
+					break
+				}
+			}
+			return
+		}
+		current = current.children[d]
+	}
+}
+
+// Search возвращает пины с хэшем не дальше maxDistance, отсортированные по расстоянию,
+// затем по ID. limit <= 0 означает без ограничения
+func (idx *Index) Search(hash uint64, maxDistance int, limit int) []Match {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var matches []Match
+	if idx.root == nil {
+		return matches
+	}
+
+	stack := []*node{idx.root}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := distance(current.hash, hash)
+		if d <= maxDistance {
+			for _, id := range current.pinIDs {
+				matches = append(matches, Match{PinID: id, Distance: d})
+			}
+		}
+
+		for childDistance, child := range current.children {
+			if childDistance >= d-maxDistance && childDistance <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].PinID < matches[j].PinID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Len возвращает количество пинов в индексе
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.hashes)
+}
+
+// SyncedUntil возвращает наибольший created_at пина, загруженного из базы
+func (idx *Index) SyncedUntil() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.syncedUntil
+}
+
+func (idx *Index) advanceSync(t time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if t.After(idx.syncedUntil) {
+		idx.syncedUntil = t
+	}
+}
+
+func distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
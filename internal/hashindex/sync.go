@@ -0,0 +1,76 @@
+package hashindex
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// syncBatchSize ограничивает количество пинов, загружаемых за один запрос
+const syncBatchSize = 5000
+
+// syncOverlap — насколько раньше отметки синхронизации перечитываются пины. ID и created_at
+// назначаются до коммита, поэтому пин может стать видимым позже пинов с большим created_at;
+// окно покрывает долгие транзакции и расхождение часов реплик. Повторная загрузка хэша ничего не меняет
+const syncOverlap = 10 * time.Minute
+
+// Load дозагружает в индекс хэши пинов, созданных начиная с отметки синхронизации минус syncOverlap.
+// При первом вызове загружает все хэши
+func (idx *Index) Load(db *gorm.DB) (int, error) {
+	from := idx.SyncedUntil()
+	if !from.IsZero() {
+		from = from.Add(-syncOverlap)
+	}
+
+	loaded := 0
+	lastCreatedAt, lastID := from, 0
+	for {
+		var pins []struct {
+			ID        int
+			PHash     int64 `gorm:"column:phash"`
+			CreatedAt time.Time
+		}
+		if err := db.Table("pins").
+			Select("id", "phash", "created_at").
+			Where("phash IS NOT NULL AND (created_at, id) > (?, ?)", lastCreatedAt, lastID).
+			Order("created_at ASC, id ASC").
+			Limit(syncBatchSize).
+			Scan(&pins).Error; err != nil {
+			return loaded, fmt.Errorf("failed to load pin hashes: %w", err)
+		}
+
+		for _, pin := range pins {
+			idx.Add(pin.ID, uint64(pin.PHash))
+		}
+		loaded += len(pins)
+
+		if len(pins) > 0 {
+			last := pins[len(pins)-1]
+			lastCreatedAt, lastID = last.CreatedAt, last.ID
+			idx.advanceSync(last.CreatedAt)
+		}
+		if len(pins) < syncBatchSize {
+			return loaded, nil
+		}
+	}
+}
+
+// StartSync периодически подтягивает хэши пинов, загруженных через другие реплики API.
+// Удаленные на других репликах пины отсеиваются при проверке результатов поиска по базе
+func (idx *Index) StartSync(db *gorm.DB, interval time.Duration, logger *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			loaded, err := idx.Load(db)
+			if err != nil {
+				logger.Error("failed to sync hash index", "error", err)
+				continue
+			}
+			logger.Debug("synced hash index", "loaded", loaded, "total", idx.Len())
+		}
+	}()
+}
@@ -0,0 +1,27 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// Appearance — характеристики, которые считаются по пикселям изображения при загрузке
+type Appearance struct {
+	PHash    uint64
+	Palette  []string
+	BlurHash string
+}
+
+// Analyze декодирует изображение один раз и считает перцептивный хэш, палитру и BlurHash
+func Analyze(r io.Reader) (*Appearance, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return &Appearance{
+		PHash:    DHash(img),
+		Palette:  ExtractPalette(img),
+		BlurHash: BlurHash(img),
+	}, nil
+}
@@ -0,0 +1,149 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// PaletteSize — сколько доминирующих цветов сохраняется для изображения
+const PaletteSize = 5
+
+// minPaletteDistance — минимальное расстояние ΔE между цветами палитры, чтобы не хранить оттенки одного цвета
+const minPaletteDistance = 12
+
+// Lab — цвет в пространстве CIELAB, где евклидово расстояние близко к воспринимаемой разнице цветов
+type Lab struct {
+	L float64
+	A float64
+	B float64
+}
+
+// Distance возвращает ΔE (CIE76) между двумя цветами
+func (c Lab) Distance(other Lab) float64 {
+	return math.Sqrt((c.L-other.L)*(c.L-other.L) + (c.A-other.A)*(c.A-other.A) + (c.B-other.B)*(c.B-other.B))
+}
+
+// ParseHexColor разбирает цвет вида "#rrggbb" или "rrggbb"
+func ParseHexColor(s string) (r, g, b uint8, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid color %q", s)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// HexToLab переводит цвет "#rrggbb" в CIELAB
+func HexToLab(s string) (Lab, error) {
+	r, g, b, err := ParseHexColor(s)
+	if err != nil {
+		return Lab{}, err
+	}
+	return RGBToLab(r, g, b), nil
+}
+
+// RGBToLab переводит цвет sRGB в CIELAB (опорная точка D65)
+func RGBToLab(r, g, b uint8) Lab {
+	lr, lg, lb := srgbToLinear(float64(r)/255), srgbToLinear(float64(g)/255), srgbToLinear(float64(b)/255)
+
+	x := (lr*0.4124564 + lg*0.3575761 + lb*0.1804375) / 0.95047
+	y := lr*0.2126729 + lg*0.7151522 + lb*0.0721750
+	z := (lr*0.0193339 + lg*0.1191920 + lb*0.9503041) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+// ExtractPalette возвращает до PaletteSize доминирующих цветов изображения в формате "#rrggbb",
+// от самого распространенного. Цвета группируются по гистограмме с шагом 16 на канал,
+// близкие по ΔE группы объединяются, редкие отбрасываются
+func ExtractPalette(img image.Image) []string {
+	small := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	type bucket struct {
+		r, g, b, count int
+	}
+	buckets := make(map[int]*bucket)
+	total := 0
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		// Почти прозрачные пиксели не влияют на восприятие цвета
+		if small.Pix[i+3] < 128 {
+			continue
+		}
+		r, g, b := int(small.Pix[i]), int(small.Pix[i+1]), int(small.Pix[i+2])
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.r += r
+		bk.g += g
+		bk.b += b
+		bk.count++
+		total++
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].count > sorted[j].count })
+
+	var palette []string
+	var picked []Lab
+	for _, bk := range sorted {
+		// Цвета, занимающие меньше процента площади, — обычно сглаживание на границах
+		if bk.count*100 < total {
+			break
+		}
+		r, g, b := uint8(bk.r/bk.count), uint8(bk.g/bk.count), uint8(bk.b/bk.count)
+		lab := RGBToLab(r, g, b)
+
+		similar := false
+		for _, p := range picked {
+			if p.Distance(lab) < minPaletteDistance {
+				similar = true
+				break
+			}
+		}
+		if similar {
+			continue
+		}
+
+		picked = append(picked, lab)
+		palette = append(palette, fmt.Sprintf("#%02x%02x%02x", r, g, b))
+		if len(palette) == PaletteSize {
+			break
+		}
+	}
+	return palette
+}
@@ -0,0 +1,90 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// countGIFFrames считает кадры GIF, проходя по блокам без декодирования изображений
+func countGIFFrames(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+
+	// Заголовок (6) + логический дескриптор экрана (7)
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, err
+	}
+	if flags := header[10]; flags&0x80 != 0 {
+		if err := skipBytes(br, 3*(1<<((flags&0x07)+1))); err != nil {
+			return 0, err
+		}
+	}
+
+	frames := 0
+	for {
+		introducer, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return frames, nil
+			}
+			return 0, err
+		}
+
+		switch introducer {
+		case 0x21: // расширение
+			if _, err := br.ReadByte(); err != nil {
+				return 0, err
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return 0, err
+			}
+		case 0x2C: // дескриптор изображения
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(br, desc); err != nil {
+				return 0, err
+			}
+			if flags := desc[8]; flags&0x80 != 0 {
+				if err := skipBytes(br, 3*(1<<((flags&0x07)+1))); err != nil {
+					return 0, err
+				}
+			}
+			// Минимальный размер кода LZW
+			if _, err := br.ReadByte(); err != nil {
+				return 0, err
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // завершающий блок
+			return frames, nil
+		default:
+			if frames > 0 {
+				// Мусор после кадров встречается часто, браузеры его игнорируют
+				return frames, nil
+			}
+			return 0, fmt.Errorf("unexpected gif block 0x%02x", introducer)
+		}
+	}
+}
+
+func skipSubBlocks(br *bufio.Reader) error {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if err := skipBytes(br, int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+func skipBytes(br *bufio.Reader, n int) error {
+	_, err := br.Discard(n)
+	return err
+}
@@ -0,0 +1,161 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // регистрируем декодер GIF для image.DecodeConfig
+	_ "image/jpeg" // регистрируем декодер JPEG для image.DecodeConfig
+	_ "image/png"  // регистрируем декодер PNG для image.DecodeConfig
+	"io"
+)
+
+// Типы пинов, которые хранятся в pins.type
+const (
+	TypeImage = "image"
+	TypeGIF   = "gif"
+	TypeVideo = "video"
+)
+
+// MaxPixels ограничивает размер изображения, чтобы не декодировать "бомбы" с огромным холстом
+const MaxPixels = 100_000_000
+
+// ErrUnsupportedType возвращается для файлов, не входящих в список разрешенных форматов
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+// ErrAnimatedWebP возвращается для анимированного WebP: его кадры нечем декодировать,
+// поэтому ни очистить метаданные, ни посчитать хэш нельзя. Оборачивает ErrUnsupportedType
+var ErrAnimatedWebP = fmt.Errorf("animated webp: %w", ErrUnsupportedType)
+
+// Info описывает медиафайл по результатам разбора его содержимого
+type Info struct {
+	MIME     string
+	Ext      string
+	Type     string
+	Width    int
+	Height   int
+	Duration float64 // в секундах, только для видео
+	Animated bool
+	Frames   int
+}
+
+type format struct {
+	mime string
+	ext  string
+	kind string
+}
+
+var (
+	formatJPEG = format{"image/jpeg", ".jpg", TypeImage}
+	formatPNG  = format{"image/png", ".png", TypeImage}
+	formatGIF  = format{"image/gif", ".gif", TypeImage}
+	formatWebP = format{"image/webp", ".webp", TypeImage}
+	formatMP4  = format{"video/mp4", ".mp4", TypeVideo}
+	formatWebM = format{"video/webm", ".webm", TypeVideo}
+)
+
+// sniff определяет формат по сигнатуре в начале файла
+func sniff(header []byte) (format, bool) {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return formatJPEG, true
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG, true
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return formatGIF, true
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return formatWebP, true
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")) && isMP4Brand(header[8:12]):
+		return formatMP4, true
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return formatWebM, true
+	}
+	return format{}, false
+}
+
+func isMP4Brand(brand []byte) bool {
+	switch string(brand) {
+	case "isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "dash", "M4V ", "MSNV", "qt  ":
+		return true
+	}
+	return false
+}
+
+// Inspect определяет тип файла по сигнатуре и извлекает размеры и длительность,
+// не доверяя данным клиента. После вызова позиция r не определена
+func Inspect(r io.ReadSeeker) (Info, error) {
+	header := make([]byte, 32)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Info{}, fmt.Errorf("failed to read file header: %w", err)
+	}
+	header = header[:n]
+
+	f, ok := sniff(header)
+	if !ok {
+		return Info{}, ErrUnsupportedType
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+
+	info := Info{MIME: f.mime, Ext: f.ext, Type: f.kind}
+
+	switch f {
+	case formatJPEG, formatPNG:
+		cfg, _, err := image.DecodeConfig(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to decode image: %w", err)
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+	case formatGIF:
+		cfg, _, err := image.DecodeConfig(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to decode image: %w", err)
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return Info{}, err
+		}
+		frames, err := countGIFFrames(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to read gif frames: %w", err)
+		}
+		info.Frames = frames
+		if frames > 1 {
+			info.Animated = true
+			info.Type = TypeGIF
+		}
+	case formatWebP:
+		w, h, animated, err := webpInfo(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to decode webp: %w", err)
+		}
+		if animated {
+			return Info{}, ErrAnimatedWebP
+		}
+		info.Width, info.Height = w, h
+	case formatMP4:
+		w, h, d, err := mp4Info(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to parse mp4: %w", err)
+		}
+		info.Width, info.Height, info.Duration = w, h, d
+	case formatWebM:
+		w, h, d, err := webmInfo(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to parse webm: %w", err)
+		}
+		info.Width, info.Height, info.Duration = w, h, d
+	}
+
+	if info.Width <= 0 || info.Height <= 0 {
+		return Info{}, fmt.Errorf("could not determine media dimensions")
+	}
+	if info.Type != TypeVideo && info.Width*info.Height > MaxPixels {
+		return Info{}, fmt.Errorf("image is too large: %dx%d", info.Width, info.Height)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,182 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp4Box описывает заголовок бокса ISO BMFF
+type mp4Box struct {
+	typ        string
+	dataOffset int64
+	dataSize   int64
+}
+
+// readMP4Box читает заголовок бокса с текущей позиции. end — граница родительского бокса
+func readMP4Box(r io.ReadSeeker, offset, end int64) (mp4Box, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return mp4Box{}, err
+	}
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return mp4Box{}, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	box := mp4Box{typ: string(header[4:8]), dataOffset: offset + 8}
+
+	switch size {
+	case 0:
+		size = end - offset
+	case 1:
+		large := make([]byte, 8)
+		if _, err := io.ReadFull(r, large); err != nil {
+			return mp4Box{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(large))
+		box.dataOffset += 8
+	}
+
+	box.dataSize = offset + size - box.dataOffset
+	if box.dataSize < 0 || offset+size > end {
+		return mp4Box{}, fmt.Errorf("invalid %q box size", box.typ)
+	}
+	return box, nil
+}
+
+// mp4Info извлекает размеры видеодорожки и длительность ролика из боксов moov/mvhd и trak/tkhd
+func mp4Info(r io.ReadSeeker) (width, height int, duration float64, err error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	moov, found, err := findMP4Box(r, 0, end, "moov")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !found {
+		return 0, 0, 0, fmt.Errorf("moov box not found")
+	}
+
+	moovEnd := moov.dataOffset + moov.dataSize
+	for offset := moov.dataOffset; offset+8 <= moovEnd; {
+		box, err := readMP4Box(r, offset, moovEnd)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		switch box.typ {
+		case "mvhd":
+			duration, err = readMVHD(r, box)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+		case "trak":
+			w, h, isVideo, err := readTrak(r, box)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if isVideo && width == 0 {
+				width, height = w, h
+			}
+		}
+
+		offset = box.dataOffset + box.dataSize
+	}
+
+	return width, height, duration, nil
+}
+
+// findMP4Box ищет бокс указанного типа среди прямых потомков диапазона [start, end)
+func findMP4Box(r io.ReadSeeker, start, end int64, typ string) (mp4Box, bool, error) {
+	for offset := start; offset+8 <= end; {
+		box, err := readMP4Box(r, offset, end)
+		if err != nil {
+			return mp4Box{}, false, err
+		}
+		if box.typ == typ {
+			return box, true, nil
+		}
+		offset = box.dataOffset + box.dataSize
+	}
+	return mp4Box{}, false, nil
+}
+
+func readMVHD(r io.ReadSeeker, box mp4Box) (float64, error) {
+	data, err := readBoxData(r, box, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	var timescale uint32
+	var units uint64
+	if data[0] == 1 {
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		units = binary.BigEndian.Uint64(data[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		units = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+	if timescale == 0 {
+		return 0, nil
+	}
+	return float64(units) / float64(timescale), nil
+}
+
+// readTrak возвращает размеры из tkhd и признак видеодорожки по обработчику в mdia/hdlr
+func readTrak(r io.ReadSeeker, trak mp4Box) (width, height int, isVideo bool, err error) {
+	trakEnd := trak.dataOffset + trak.dataSize
+
+	tkhd, found, err := findMP4Box(r, trak.dataOffset, trakEnd, "tkhd")
+	if err != nil || !found {
+		return 0, 0, false, err
+	}
+	data, err := readBoxData(r, tkhd, 92)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	sizeOffset := 76
+	if data[0] == 1 {
+		sizeOffset = 88
+	}
+	// Ширина и высота хранятся в формате 16.16
+	width = int(binary.BigEndian.Uint32(data[sizeOffset:sizeOffset+4]) >> 16)
+	height = int(binary.BigEndian.Uint32(data[sizeOffset+4:sizeOffset+8]) >> 16)
+
+	mdia, found, err := findMP4Box(r, trak.dataOffset, trakEnd, "mdia")
+	if err != nil || !found {
+		return width, height, width > 0 && height > 0, err
+	}
+	hdlr, found, err := findMP4Box(r, mdia.dataOffset, mdia.dataOffset+mdia.dataSize, "hdlr")
+	if err != nil || !found {
+		return width, height, width > 0 && height > 0, err
+	}
+	hdlrData, err := readBoxData(r, hdlr, 12)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return width, height, string(hdlrData[8:12]) == "vide", nil
+}
+
+// readBoxData читает начало содержимого бокса. Если бокс короче size (например, версия 0
+// с 32-битными полями), хвост буфера остается нулевым
+func readBoxData(r io.ReadSeeker, box mp4Box, size int) ([]byte, error) {
+	if box.dataSize < 4 {
+		return nil, fmt.Errorf("%q box is too short", box.typ)
+	}
+	n := int64(size)
+	if box.dataSize < n {
+		n = box.dataSize
+	}
+	if _, err := r.Seek(box.dataOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data[:n]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
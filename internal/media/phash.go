@@ -0,0 +1,46 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// DuplicateThreshold — максимальное расстояние Хэмминга между dHash, при котором
+// изображения считаются одинаковыми (пересжатие, ресайз, небольшая обрезка)
+const DuplicateThreshold = 8
+
+// HashImage декодирует изображение и считает его перцептивный хэш
+func HashImage(r io.Reader) (uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return DHash(img), nil
+}
+
+// DHash считает разностный хэш: изображение уменьшается до 9x8 в оттенках серого,
+// каждый бит — больше ли пиксель своего правого соседа
+func DHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HammingDistance возвращает количество различающихся битов двух хэшей
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
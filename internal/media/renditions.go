@@ -0,0 +1,135 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"pornterest/internal/models"
+	"pornterest/internal/storage"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // регистрируем декодер WebP для image.Decode
+)
+
+// RenditionSpec описывает уменьшенную копию изображения заданной ширины
+type RenditionSpec struct {
+	Name  string
+	Width int
+}
+
+// RenditionSpecs — размеры, которые генерируются для каждого изображения.
+// Оригинал отдается как есть и отдельной копией не хранится
+var RenditionSpecs = []RenditionSpec{
+	{Name: "grid", Width: 236},
+	{Name: "detail", Width: 736},
+}
+
+// RenditionOriginal — имя, под которым в ответах отдается исходный файл
+const RenditionOriginal = "original"
+
+// Rendition — закодированная уменьшенная копия изображения
+type Rendition struct {
+	Name   string
+	Width  int
+	Height int
+	MIME   string
+	Ext    string
+	Data   []byte
+}
+
+// GenerateRenditions декодирует изображение и строит копии по RenditionSpecs.
+// Копии шире исходника не создаются
+func GenerateRenditions(r io.Reader) ([]Rendition, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return renditionsFromImage(src)
+}
+
+func renditionsFromImage(src image.Image) ([]Rendition, error) {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW == 0 || srcH == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+
+	// Для непрозрачных изображений используем JPEG, иначе PNG, чтобы не потерять альфа-канал
+	opaque := true
+	if o, ok := src.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+
+	var renditions []Rendition
+	for _, spec := range RenditionSpecs {
+		if spec.Width >= srcW {
+			continue
+		}
+
+		height := srcH * spec.Width / srcW
+		if height < 1 {
+			height = 1
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, spec.Width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+		var buf bytes.Buffer
+		rendition := Rendition{Name: spec.Name, Width: spec.Width, Height: height}
+		if opaque {
+			if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+				return nil, fmt.Errorf("failed to encode %s rendition: %w", spec.Name, err)
+			}
+			rendition.MIME, rendition.Ext = "image/jpeg", ".jpg"
+		} else {
+			if err := png.Encode(&buf, dst); err != nil {
+				return nil, fmt.Errorf("failed to encode %s rendition: %w", spec.Name, err)
+			}
+			rendition.MIME, rendition.Ext = "image/png", ".png"
+		}
+		rendition.Data = buf.Bytes()
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+// StoreRenditions генерирует копии изображения и сохраняет их в хранилище рядом с оригиналом.
+// Возвращает записи для pin_renditions; сохранять их в базу должен вызывающий.
+// При ошибке уже загруженные копии удаляются
+func StoreRenditions(ctx context.Context, store storage.Storage, pinID int, originalKey string, src io.Reader) ([]models.PinRendition, error) {
+	renditions, err := GenerateRenditions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(originalKey, path.Ext(originalKey))
+	rows := make([]models.PinRendition, 0, len(renditions))
+	for _, rendition := range renditions {
+		key := fmt.Sprintf("%s_%s%s", base, rendition.Name, rendition.Ext)
+		if err := store.Put(ctx, key, bytes.NewReader(rendition.Data), int64(len(rendition.Data)), rendition.MIME); err != nil {
+			for _, row := range rows {
+				store.Delete(ctx, row.Key)
+			}
+			return nil, err
+		}
+		rows = append(rows, models.PinRendition{
+			PinID:     pinID,
+			Name:      rendition.Name,
+			Key:       key,
+			Width:     rendition.Width,
+			Height:    rendition.Height,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,254 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Sanitized — изображение без метаданных, развернутое согласно EXIF Orientation
+type Sanitized struct {
+	Data   []byte
+	MIME   string
+	Ext    string
+	Width  int
+	Height int
+}
+
+// Sanitize удаляет из JPEG, PNG и WebP метаданные (EXIF с GPS и серийными номерами, XMP, IPTC,
+// текстовые комментарии). Если EXIF требует поворота, изображение сначала разворачивается
+// и перекодируется, иначе метаданные вырезаются без перекодирования
+func Sanitize(r io.Reader, info Info) (Sanitized, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Sanitized{}, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	result := Sanitized{MIME: info.MIME, Ext: info.Ext, Width: info.Width, Height: info.Height}
+
+	var orientation int
+	switch info.MIME {
+	case formatJPEG.mime:
+		result.Data, orientation, err = stripJPEG(data)
+	case formatPNG.mime:
+		result.Data, orientation, err = stripPNG(data)
+	case formatWebP.mime:
+		result.Data, orientation, err = stripWebP(data)
+	default:
+		result.Data = data
+		return result, nil
+	}
+	if err != nil {
+		return Sanitized{}, err
+	}
+
+	if orientation <= 1 {
+		return result, nil
+	}
+
+	// Поворот требует перекодирования. WebP-кодировщика нет, поэтому такие файлы сохраняются в PNG
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Sanitized{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	oriented := applyOrientation(src, orientation)
+
+	var buf bytes.Buffer
+	if info.MIME == formatJPEG.mime {
+		err = jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: 92})
+	} else {
+		err = png.Encode(&buf, oriented)
+		result.MIME, result.Ext = formatPNG.mime, formatPNG.ext
+	}
+	if err != nil {
+		return Sanitized{}, fmt.Errorf("failed to encode oriented image: %w", err)
+	}
+
+	result.Data = buf.Bytes()
+	result.Width, result.Height = oriented.Bounds().Dx(), oriented.Bounds().Dy()
+	return result, nil
+}
+
+// stripJPEG вырезает сегменты APP1 (EXIF, XMP), APP13 (IPTC) и COM.
+// JFIF (APP0), ICC-профиль (APP2) и Adobe (APP14) нужны для правильных цветов и остаются
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, fmt.Errorf("invalid jpeg")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, fmt.Errorf("invalid jpeg marker at %d", pos)
+		}
+		marker := data[pos+1]
+
+		// Начало скана: дальше сжатые данные без сегментов метаданных
+		if marker == 0xDA {
+			out.Write(data[pos:])
+			return out.Bytes(), orientation, nil
+		}
+		// Заполнители и маркеры без длины
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, fmt.Errorf("invalid jpeg segment length")
+		}
+		payload := data[pos+4 : end]
+
+		switch marker {
+		case 0xE1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+		case 0xED, 0xFE:
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	return nil, 0, fmt.Errorf("jpeg has no image data")
+}
+
+// stripPNG удаляет чанки eXIf, tEXt, zTXt, iTXt и tIME
+func stripPNG(data []byte) ([]byte, int, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen {
+		return nil, 0, fmt.Errorf("invalid png")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLen])
+	orientation := 1
+
+	pos := signatureLen
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, 0, fmt.Errorf("invalid png chunk length")
+		}
+		chunkType := string(data[pos+4 : pos+8])
+
+		switch chunkType {
+		case "eXIf":
+			orientation = exifOrientation(data[pos+8 : pos+8+length])
+		case "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[pos:end])
+		}
+
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out.Bytes(), orientation, nil
+}
+
+// stripWebP удаляет чанки EXIF и XMP и снимает соответствующие флаги в VP8X
+func stripWebP(data []byte) ([]byte, int, error) {
+	if len(data) < 12 {
+		return nil, 0, fmt.Errorf("invalid webp")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	orientation := 1
+
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		// Чанки выравниваются до четной длины
+		end := pos + 8 + length + length%2
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch chunkType {
+		case "EXIF":
+			payload := data[pos+8 : min(pos+8+length, len(data))]
+			orientation = exifOrientation(bytes.TrimPrefix(payload, []byte("Exif\x00\x00")))
+		case "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, orientation, nil
+}
+
+// applyOrientation разворачивает изображение согласно значению EXIF Orientation (1–8)
+func applyOrientation(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	// Для простых случаев работаем с NRGBA напрямую, чтобы не вызывать At на каждом пикселе
+	nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(nrgba, nrgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			si := nrgba.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], nrgba.Pix[si:si+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,231 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// Идентификаторы элементов Matroska/WebM, которые нужны для размеров и длительности
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlVideo         = 0xE0
+	ebmlPixelWidth    = 0xB0
+	ebmlPixelHeight   = 0xBA
+	ebmlCluster       = 0x1F43B675
+)
+
+// ebmlUnknownSize обозначает элемент неизвестной длины (используется при потоковой записи)
+const ebmlUnknownSize = -1
+
+// ebmlChildren — какие из нужных нам элементов могут лежать в каждом контейнере (0 — корень файла).
+// Спускаемся только по этой схеме, поэтому глубина рекурсии ограничена цепочкой
+// Segment → Tracks → TrackEntry → Video, как бы ни были вложены элементы в самом файле.
+// Cluster внутрь не читается, но как контейнер завершает Info или Tracks неизвестной длины
+var ebmlChildren = map[int64][]int64{
+	0:              {ebmlSegment},
+	ebmlSegment:    {ebmlInfo, ebmlTracks, ebmlCluster},
+	ebmlInfo:       {ebmlTimecodeScale, ebmlDuration},
+	ebmlTracks:     {ebmlTrackEntry},
+	ebmlTrackEntry: {ebmlVideo},
+	ebmlVideo:      {ebmlPixelWidth, ebmlPixelHeight},
+	ebmlCluster:    nil,
+}
+
+type webmState struct {
+	width, height  int
+	timecodeScale  uint64
+	durationUnits  float64
+	reachedCluster bool
+}
+
+// webmInfo извлекает размеры первой видеодорожки и длительность из заголовков WebM
+func webmInfo(r io.ReadSeeker) (width, height int, duration float64, err error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, 0, err
+	}
+
+	st := &webmState{timecodeScale: 1000000}
+	if _, err := walkEBML(r, 0, false, 0, end, st); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, 0, 0, err
+	}
+
+	// Длительность хранится в единицах TimecodeScale (наносекунды на единицу)
+	duration = st.durationUnits * float64(st.timecodeScale) / 1e9
+	return st.width, st.height, duration, nil
+}
+
+// walkEBML читает дочерние элементы контейнера parent в диапазоне [offset, end) и возвращает
+// смещение, на котором остановилась. Контейнер неизвестной длины (unsized) заканчивается там,
+// где встретился контейнер более высокого уровня: с этого смещения чтение продолжает родитель
+func walkEBML(r io.ReadSeeker, parent int64, unsized bool, offset, end int64, st *webmState) (int64, error) {
+	for offset < end && !st.reachedCluster {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return offset, err
+		}
+		id, idLen, err := readEBMLVint(r, false)
+		if err != nil {
+			return offset, err
+		}
+		size, sizeLen, err := readEBMLVint(r, true)
+		if err != nil {
+			return offset, err
+		}
+
+		dataOffset := offset + int64(idLen+sizeLen)
+		dataEnd := end
+		if size != ebmlUnknownSize {
+			dataEnd = dataOffset + size
+			if dataEnd > end {
+				dataEnd = end
+			}
+		}
+
+		if !slices.Contains(ebmlChildren[parent], id) {
+			if _, container := ebmlChildren[id]; container && unsized {
+				return offset, nil
+			}
+			// Чужой элемент пропускаем целиком, а неизвестную длину пропустить нельзя
+			if size == ebmlUnknownSize {
+				return end, nil
+			}
+			offset = dataEnd
+			continue
+		}
+
+		switch id {
+		case ebmlSegment, ebmlInfo, ebmlTracks, ebmlTrackEntry, ebmlVideo:
+			next, err := walkEBML(r, id, size == ebmlUnknownSize, dataOffset, dataEnd, st)
+			if err != nil {
+				return next, err
+			}
+			if size == ebmlUnknownSize {
+				offset = next
+				continue
+			}
+		case ebmlCluster:
+			// Заголовки всегда идут до кластеров с данными, дальше читать незачем
+			st.reachedCluster = true
+			return offset, nil
+		case ebmlTimecodeScale:
+			v, err := readEBMLUint(r, size)
+			if err != nil {
+				return offset, err
+			}
+			if v > 0 {
+				st.timecodeScale = v
+			}
+		case ebmlDuration:
+			v, err := readEBMLFloat(r, size)
+			if err != nil {
+				return offset, err
+			}
+			st.durationUnits = v
+		case ebmlPixelWidth:
+			v, err := readEBMLUint(r, size)
+			if err != nil {
+				return offset, err
+			}
+			if st.width == 0 {
+				st.width = int(v)
+			}
+		case ebmlPixelHeight:
+			v, err := readEBMLUint(r, size)
+			if err != nil {
+				return offset, err
+			}
+			if st.height == 0 {
+				st.height = int(v)
+			}
+		}
+
+		if size == ebmlUnknownSize {
+			return end, nil
+		}
+		offset = dataEnd
+	}
+	return offset, nil
+}
+
+// readEBMLVint читает целое переменной длины. Для идентификаторов маркер длины сохраняется,
+// для размеров — отбрасывается; размер из одних единиц означает неизвестную длину
+func readEBMLVint(r io.Reader, stripMarker bool) (int64, int, error) {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(r, first); err != nil {
+		return 0, 0, err
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, fmt.Errorf("invalid EBML variable-length integer")
+	}
+
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, err
+	}
+
+	value := int64(first[0])
+	if stripMarker {
+		value &= int64(0xFF >> length)
+	}
+	allOnes := value == int64(0xFF>>length)
+	for _, b := range rest {
+		value = value<<8 | int64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+
+	if stripMarker && allOnes {
+		return ebmlUnknownSize, length, nil
+	}
+	return value, length, nil
+}
+
+func readEBMLUint(r io.Reader, size int64) (uint64, error) {
+	if size < 0 || size > 8 {
+		return 0, fmt.Errorf("invalid EBML uint size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func readEBMLFloat(r io.Reader, size int64) (float64, error) {
+	switch size {
+	case 4:
+		data := make([]byte, 4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 8:
+		data := make([]byte, 8)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 0:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid EBML float size %d", size)
+}
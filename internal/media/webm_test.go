@@ -0,0 +1,115 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+var (
+	ebmlHeader  = []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80}
+	unknownSize = []byte{0xFF}
+)
+
+// element кодирует элемент EBML с известной длиной; id записывается вместе с маркером длины
+func element(id []byte, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01 // восьмибайтовая длина
+	return append(append(append([]byte{}, id...), size...), data...)
+}
+
+// unsized кодирует начало элемента неизвестной длины
+func unsized(id []byte) []byte {
+	return append(append([]byte{}, id...), unknownSize...)
+}
+
+func uintElement(id []byte, v uint16) []byte {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, v)
+	return element(id, data)
+}
+
+func floatElement(id []byte, v float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(v))
+	return element(id, data)
+}
+
+var (
+	idSegment    = []byte{0x18, 0x53, 0x80, 0x67}
+	idInfo       = []byte{0x15, 0x49, 0xA9, 0x66}
+	idDuration   = []byte{0x44, 0x89}
+	idTracks     = []byte{0x16, 0x54, 0xAE, 0x6B}
+	idTrackEntry = []byte{0xAE}
+	idVideo      = []byte{0xE0}
+	idWidth      = []byte{0xB0}
+	idHeight     = []byte{0xBA}
+	idCluster    = []byte{0x1F, 0x43, 0xB6, 0x75}
+	idVoid       = []byte{0xEC}
+)
+
+func TestWebmInfo(t *testing.T) {
+	video := element(idVideo, uintElement(idWidth, 640), uintElement(idHeight, 360))
+	info := element(idInfo, floatElement(idDuration, 2500))
+	tracks := element(idTracks, element(idTrackEntry, video))
+
+	tests := []struct {
+		name          string
+		input         []byte
+		width, height int
+		duration      float64
+	}{
+		{
+			name:  "sized elements",
+			input: bytes.Join([][]byte{ebmlHeader, element(idSegment, info, element(idVoid, []byte{1, 2}), tracks)}, nil),
+			width: 640, height: 360, duration: 2.5,
+		},
+		{
+			name: "live stream with unknown sizes",
+			input: bytes.Join([][]byte{
+				ebmlHeader, unsized(idSegment), unsized(idInfo), floatElement(idDuration, 2500),
+				unsized(idTracks), unsized(idTrackEntry), video, unsized(idCluster),
+			}, nil),
+			width: 640, height: 360, duration: 2.5,
+		},
+		{
+			name:  "dimensions outside of video are ignored",
+			input: bytes.Join([][]byte{ebmlHeader, element(idSegment, uintElement(idWidth, 1), uintElement(idHeight, 1), tracks)}, nil),
+			width: 640, height: 360,
+		},
+	}
+
+	for _, tt := range tests {
+		width, height, duration, err := webmInfo(bytes.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("%s: webmInfo returned error: %v", tt.name, err)
+		}
+		if width != tt.width || height != tt.height || duration != tt.duration {
+			t.Errorf("%s: webmInfo = %dx%d %.2fs, want %dx%d %.2fs",
+				tt.name, width, height, duration, tt.width, tt.height, tt.duration)
+		}
+	}
+}
+
+// Вложенные друг в друга Video неизвестной длины раньше разбирались рекурсией без предела
+// и роняли процесс с переполнением стека
+func TestWebmInfoDeeplyNested(t *testing.T) {
+	nested := bytes.Repeat(unsized(idVideo), 8<<20)
+	inputs := map[string][]byte{
+		"at root":           append(append([]byte{}, ebmlHeader...), nested...),
+		"inside trackentry": bytes.Join([][]byte{ebmlHeader, unsized(idSegment), unsized(idTracks), unsized(idTrackEntry), nested}, nil),
+	}
+
+	for name, input := range inputs {
+		width, height, _, err := webmInfo(bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("%s: webmInfo returned error: %v", name, err)
+		}
+		if width != 0 || height != 0 {
+			t.Errorf("%s: webmInfo = %dx%d, want no dimensions", name, width, height)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// webpInfo читает размеры WebP из первого чанка (VP8X, VP8 или VP8L)
+func webpInfo(r io.Reader) (width, height int, animated bool, err error) {
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, false, err
+	}
+
+	chunk := header[12:16]
+	data := header[20:]
+
+	switch string(chunk) {
+	case "VP8X":
+		// Флаги (1) + зарезервировано (3) + ширина-1 (3) + высота-1 (3)
+		animated = data[0]&0x02 != 0
+		width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+		height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+	case "VP8 ":
+		// Кадр: тег (3) + стартовый код 9d 01 2a (3) + ширина (2) + высота (2), старшие 2 бита — масштаб
+		if data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+			return 0, 0, false, fmt.Errorf("invalid VP8 start code")
+		}
+		width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff)
+	case "VP8L":
+		// Сигнатура 0x2f, затем 14 бит ширины-1 и 14 бит высоты-1
+		if data[0] != 0x2f {
+			return 0, 0, false, fmt.Errorf("invalid VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[1:5])
+		width = int(bits&0x3fff) + 1
+		height = int((bits>>14)&0x3fff) + 1
+	default:
+		return 0, 0, false, fmt.Errorf("unknown webp chunk %q", chunk)
+	}
+
+	return width, height, animated, nil
+}
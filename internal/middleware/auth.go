@@ -65,3 +65,45 @@ func AuthMiddleware(cfg config.Config) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// OptionalAuthMiddleware добавляет ID пользователя в контекст, если передан валидный токен,
+// но пропускает запрос и без него. Используется для публичных маршрутов, ответ которых
+// зависит от того, кто смотрит
+func OptionalAuthMiddleware(cfg config.Config) func(http.Handler) http.Handler {
+	jwtSecret := cfg.JWTSecret
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(tokenString) != 2 || tokenString[0] != "Bearer" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := jwt.Parse(tokenString[1], func(token *jwt.Token) (interface{}, error) {
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return []byte(jwtSecret), nil
+			})
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+				if userID, ok := claims["user_id"].(float64); ok {
+					ctx := context.WithValue(r.Context(), UserID, int(userID))
+					r = r.WithContext(ctx)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserIDFromContext возвращает ID пользователя, если запрос прошел авторизацию
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(UserID).(int)
+	return userID, ok
+}
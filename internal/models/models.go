@@ -4,23 +4,40 @@ import "time"
 
 // Pin представляет структуру данных для пина
 type Pin struct {
-	ID               int       `json:"id"`
-	Path             string    `json:"path"`
-	Description      string    `json:"description"`
-	UserID           int       `json:"user_id"`
-	Original         *string   `json:"original"`
-	Comment          *bool     `json:"comment"`
-	Ai               *bool     `json:"ai"`
-	Type             *string   `json:"type"`
-	Title            string    `json:"title"`
-	Width            *int      `json:"width"`
-	Height           *int      `json:"height"`
-	Duration         *float64  `json:"duration"`
-	OriginalFileName *string   `json:"original_file_name"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	Comments         []Comment `gorm:"foreignKey:PinID"`
-	Tags             []PinTag  `gorm:"foreignKey:PinID" json:"tags"`
+	ID               int            `json:"id"`
+	Path             string         `json:"path"`
+	Description      string         `json:"description"`
+	UserID           int            `json:"user_id"`
+	Original         *string        `json:"original"`
+	Comment          *bool          `json:"comment"`
+	Ai               *bool          `json:"ai"`
+	Type             *string        `json:"type"`
+	Title            string         `json:"title"`
+	Width            *int           `json:"width"`
+	Height           *int           `json:"height"`
+	Duration         *float64       `json:"duration"`
+	OriginalFileName *string        `json:"original_file_name"`
+	PHash            *int64         `json:"-" gorm:"column:phash"`
+	DuplicateOfID    *int           `json:"duplicate_of_id"`
+	Palette          []string       `json:"palette" gorm:"serializer:json"`
+	BlurHash         *string        `json:"blurhash" gorm:"column:blurhash"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	Comments         []Comment      `gorm:"foreignKey:PinID"`
+	Tags             []PinTag       `gorm:"foreignKey:PinID" json:"tags"`
+	Renditions       []PinRendition `gorm:"foreignKey:PinID" json:"renditions"`
+}
+
+// PinRendition представляет уменьшенную копию изображения пина (сетка, детальная страница)
+type PinRendition struct {
+	ID        int       `json:"-" gorm:"primaryKey"`
+	PinID     int       `json:"-"`
+	Name      string    `json:"name"`
+	Key       string    `json:"-"`
+	URL       string    `json:"url" gorm:"-"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"-"`
 }
 
 // UploadPinRequest представляет данные, необходимые для загрузки нового пина
@@ -56,6 +73,7 @@ type User struct {
 	Comment      bool       `json:"comment"`
 	Autoplay     bool       `json:"autoplay"`
 	TwoFa        bool       `json:"2fa"`
+	Admin        bool       `json:"admin"`
 	Email        string     `json:"email"`
 	Password     string     `json:"password"`
 	CreatedAt    time.Time  `json:"created_at"`
@@ -79,6 +97,22 @@ type UserSubscription struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// TagSubscription представляет подписку пользователя на тег
+type TagSubscription struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	TagID     int       `json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserBlock представляет блокировку автора пользователем
+type UserBlock struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	TargetUserID int       `json:"target_user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // Comment представляет модель комментария
 type Comment struct {
 	ID        int       `json:"id"`
@@ -110,3 +144,49 @@ type PinTag struct {
 	TagID     int       `json:"tag_id"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Board представляет доску (коллекцию) сохраненных пинов пользователя
+type Board struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	UserID      int       `json:"user_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Secret      bool      `json:"secret"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BoardPin представляет пин на доске и его позицию
+type BoardPin struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	BoardID   int       `json:"board_id"`
+	PinID     int       `json:"pin_id"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Upload представляет состояние возобновляемой (tus) загрузки файла.
+// Полученные байты лежат во временном файле, в базе хранится сколько из них принято
+type Upload struct {
+	ID        string            `json:"id" gorm:"primaryKey"`
+	UserID    int               `json:"user_id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset" gorm:"column:upload_offset"`
+	Metadata  map[string]string `json:"metadata" gorm:"serializer:json"`
+	PinID     *int              `json:"pin_id"` // Заполняется, когда из загрузки создан пин
+	ExpiresAt time.Time         `json:"expires_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// OutboxEvent — запись outbox: изменение пина, которое нужно донести до поискового индекса.
+// Пишется в той же транзакции, что и само изменение
+type OutboxEvent struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	Event       string    `json:"event"`
+	PinID       int       `json:"pin_id"`
+	Attempts    int       `json:"attempts"`
+	LastError   *string   `json:"last_error"`
+	AvailableAt time.Time `json:"available_at"` // Раньше этого момента событие не обрабатывается
+	CreatedAt   time.Time `json:"created_at"`
+}
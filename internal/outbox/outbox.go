@@ -0,0 +1,237 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/engagement"
+	"pornterest/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Типы событий outbox
+const (
+	EventIndexPin  = "pin.index"
+	EventDeletePin = "pin.delete"
+)
+
+const (
+	// batchSize — сколько событий обработчик забирает за один проход
+	batchSize = 100
+	// leaseDuration — на сколько забранные события скрываются от других реплик на время обработки
+	leaseDuration = 5 * time.Minute
+	// maxRetryDelay ограничивает экспоненциальную задержку между попытками
+	maxRetryDelay = time.Hour
+	// pinLockClass — первый ключ advisory-блокировки пина на время обработки его события, второй — id пина
+	pinLockClass = 7_402_117
+)
+
+// Enqueue добавляет событие в outbox. tx должен быть транзакцией, в которой меняется пин,
+// тогда событие появится тогда и только тогда, когда изменение закоммичено
+func Enqueue(tx *gorm.DB, event string, pinID int) error {
+	now := time.Now()
+	if err := tx.Create(&models.OutboxEvent{
+		Event:       event,
+		PinID:       pinID,
+		AvailableAt: now,
+		CreatedAt:   now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to enqueue %s for pin %d: %w", event, pinID, err)
+	}
+	return nil
+}
+
+// EnqueueTagPins ставит в outbox переиндексацию всех пинов с тегом, например после изменения его названий
+func EnqueueTagPins(tx *gorm.DB, tagID int) error {
+	if err := tx.Exec(
+		`INSERT INTO outbox_events (event, pin_id, attempts, available_at, created_at)
+		 SELECT ?, pin_id, 0, NOW(), NOW() FROM pin_tags WHERE tag_id = ?`,
+		EventIndexPin, tagID,
+	).Error; err != nil {
+		return fmt.Errorf("failed to enqueue pins of tag %d: %w", tagID, err)
+	}
+	return nil
+}
+
+// Worker переносит события outbox в Elasticsearch, пока индекс не сойдется с базой.
+// Неудачные события повторяются с экспоненциальной задержкой
+type Worker struct {
+	db     *gorm.DB
+	es     *elasticsearch.ESClient
+	logger *slog.Logger
+}
+
+func NewWorker(db *gorm.DB, es *elasticsearch.ESClient, logger *slog.Logger) *Worker {
+	return &Worker{
+		db:     db,
+		es:     es,
+		logger: logger,
+	}
+}
+
+// Start запускает фоновую обработку outbox с заданным интервалом опроса
+func (w *Worker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// Пока события есть, разбираем их без паузы
+			for {
+				processed, err := w.ProcessBatch(context.Background())
+				if err != nil {
+					w.logger.Error("failed to process outbox", "error", err)
+					break
+				}
+				if processed < batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// ProcessBatch забирает очередную порцию готовых к обработке событий и обрабатывает их.
+// Возвращает количество забранных событий
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	events, err := w.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := w.handleLocked(ctx, event); err != nil {
+			w.retry(event, err)
+			continue
+		}
+		if err := w.db.Delete(&models.OutboxEvent{}, event.ID).Error; err != nil {
+			w.logger.Error("failed to delete processed outbox event", "error", err, "event_id", event.ID)
+		}
+	}
+
+	return len(events), nil
+}
+
+// claim выбирает события и продлевает им available_at на время обработки.
+// SKIP LOCKED позволяет нескольким репликам разбирать outbox параллельно
+func (w *Worker) claim() ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("available_at <= ?", now).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&events).Error; err != nil {
+			return fmt.Errorf("failed to fetch outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]int, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		if err := tx.Model(&models.OutboxEvent{}).
+			Where("id IN ?", ids).
+			Update("available_at", now.Add(leaseDuration)).Error; err != nil {
+			return fmt.Errorf("failed to lease outbox events: %w", err)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// handleLocked обрабатывает событие, держа advisory-блокировку его пина. SKIP LOCKED раздает события,
+// а не пины, поэтому без нее index и delete одного пина на разных репликах могли бы записаться
+// в индекс в обратном порядке, и удаленный пин остался бы в поиске
+func (w *Worker) handleLocked(ctx context.Context, event models.OutboxEvent) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", pinLockClass, event.PinID).Error; err != nil {
+			return fmt.Errorf("failed to lock pin %d: %w", event.PinID, err)
+		}
+		return w.handle(ctx, event)
+	})
+}
+
+func (w *Worker) handle(ctx context.Context, event models.OutboxEvent) error {
+	switch event.Event {
+	case EventIndexPin:
+		return w.indexPin(ctx, event.PinID)
+	case EventDeletePin:
+		return w.es.DeletePin(ctx, event.PinID)
+	default:
+		return fmt.Errorf("unknown outbox event %q", event.Event)
+	}
+}
+
+// indexPin индексирует текущее состояние пина. Если пин успел удалиться, убирает его из индекса
+func (w *Worker) indexPin(ctx context.Context, pinID int) error {
+	var pin models.Pin
+	if err := w.db.First(&pin, pinID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return w.es.DeletePin(ctx, pinID)
+		}
+		return fmt.Errorf("failed to fetch pin %d: %w", pinID, err)
+	}
+
+	var tags []models.Tag
+	if err := w.db.Table("tags").
+		Joins("JOIN pin_tags ON pin_tags.tag_id = tags.id").
+		Where("pin_tags.pin_id = ?", pinID).
+		Find(&tags).Error; err != nil {
+		return fmt.Errorf("failed to fetch tags for pin %d: %w", pinID, err)
+	}
+
+	stats, err := engagement.LoadStats(w.db, []int{pinID})
+	if err != nil {
+		return err
+	}
+
+	return w.es.IndexPin(ctx, &pin, tags, stats[pinID])
+}
+
+// retry откладывает событие на следующую попытку
+func (w *Worker) retry(event models.OutboxEvent, cause error) {
+	attempts := event.Attempts + 1
+	delay := retryDelay(attempts)
+	message := cause.Error()
+
+	w.logger.Error("outbox event failed",
+		"error", cause,
+		"event_id", event.ID,
+		"event", event.Event,
+		"pin_id", event.PinID,
+		"attempts", attempts,
+		"retry_in", delay.String(),
+	)
+
+	if err := w.db.Model(&models.OutboxEvent{}).
+		Where("id = ?", event.ID).
+		Updates(map[string]interface{}{
+			"attempts":     attempts,
+			"last_error":   message,
+			"available_at": time.Now().Add(delay),
+		}).Error; err != nil {
+		w.logger.Error("failed to reschedule outbox event", "error", err, "event_id", event.ID)
+	}
+}
+
+// retryDelay возвращает задержку перед попыткой номер attempts+1: 2с, 4с, 8с... но не больше maxRetryDelay
+func retryDelay(attempts int) time.Duration {
+	if attempts > 20 {
+		return maxRetryDelay
+	}
+	delay := time.Second << attempts
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
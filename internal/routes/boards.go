@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"net/http"
+	"pornterest/internal/config"
+	"pornterest/internal/handlers"
+	"pornterest/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupBoardRoutes регистрирует маршруты, связанные с досками
+func SetupBoardRoutes(router *mux.Router, boardHandler *handlers.BoardHandler, cfg config.Config) {
+	router.Handle("/api/users/{username}/boards", middleware.OptionalAuthMiddleware(cfg)(http.HandlerFunc(boardHandler.GetUserBoards))).Methods("GET")
+
+	router.Handle("/api/boards", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.CreateBoard))).Methods("POST")
+	router.Handle("/api/boards/{id:[0-9]+}", middleware.OptionalAuthMiddleware(cfg)(http.HandlerFunc(boardHandler.GetBoard))).Methods("GET")
+	router.Handle("/api/boards/{id:[0-9]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.UpdateBoard))).Methods("PUT")
+	router.Handle("/api/boards/{id:[0-9]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.DeleteBoard))).Methods("DELETE")
+
+	// Пины на доске
+	router.Handle("/api/boards/{id:[0-9]+}/pins", middleware.OptionalAuthMiddleware(cfg)(http.HandlerFunc(boardHandler.GetBoardPins))).Methods("GET")
+	router.Handle("/api/boards/{id:[0-9]+}/pins/order", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.ReorderBoardPins))).Methods("PUT")
+	router.Handle("/api/boards/{id:[0-9]+}/pins/{pin_id:[0-9]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.RemovePinFromBoard))).Methods("DELETE")
+	router.Handle("/api/pins/{id:[0-9]+}/boards", middleware.AuthMiddleware(cfg)(http.HandlerFunc(boardHandler.AddPinToBoards))).Methods("POST")
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"net/http"
+	"pornterest/internal/config"
+	"pornterest/internal/handlers"
+	"pornterest/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupFeedRoutes регистрирует маршрут домашней ленты
+func SetupFeedRoutes(router *mux.Router, feedHandler *handlers.FeedHandler, cfg config.Config) {
+	router.Handle("/api/feed", middleware.AuthMiddleware(cfg)(http.HandlerFunc(feedHandler.GetFeed))).Methods("GET")
+}
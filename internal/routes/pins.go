@@ -13,6 +13,8 @@ import (
 func SetupPinRoutes(router *mux.Router, pinHandler *handlers.PinHandler, actionHandler *handlers.ActionHandler, cfg config.Config) {
 	router.HandleFunc("/api/pins", pinHandler.GetPins).Methods("GET")
 	router.HandleFunc("/api/pins/{id:[0-9]+}", pinHandler.GetPin).Methods("GET")
+	router.Handle("/api/pins/{id:[0-9]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(pinHandler.UpdatePin))).Methods("PUT")
+	router.Handle("/api/pins/{id:[0-9]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(pinHandler.DeletePin))).Methods("DELETE")
 	router.Handle("/api/pin/upload", middleware.AuthMiddleware(cfg)(http.HandlerFunc(pinHandler.UploadPin))).Methods("POST")
 
 	// Маршруты для лайков
@@ -30,6 +32,13 @@ func SetupPinRoutes(router *mux.Router, pinHandler *handlers.PinHandler, actionH
 	router.Handle("/api/pins/{id:[0-9]+}/comments", middleware.AuthMiddleware(cfg)(http.HandlerFunc(pinHandler.AddComment))).Methods("POST")
 	router.HandleFunc("/api/pins/{id:[0-9]+}/comments", pinHandler.GetPinComments).Methods("GET")
 
+	// Похожие пины
+	router.Handle("/api/pins/{id:[0-9]+}/related", middleware.OptionalAuthMiddleware(cfg)(http.HandlerFunc(pinHandler.GetRelatedPins))).Methods("GET")
+
+	// Кластеры дубликатов (только для модераторов)
+	router.Handle("/api/pins/{id:[0-9]+}/duplicates", middleware.AuthMiddleware(cfg)(http.HandlerFunc(pinHandler.GetPinDuplicates))).Methods("GET")
+
 	// Поиск пинов
 	router.HandleFunc("/api/search", pinHandler.SearchPins)
+	router.HandleFunc("/api/search/image", pinHandler.SearchPinsByImage).Methods("POST")
 }
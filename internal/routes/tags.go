@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"net/http"
 	"pornterest/internal/config"
 	"pornterest/internal/handlers"
+	"pornterest/internal/middleware"
 
 	"github.com/gorilla/mux"
 )
@@ -11,5 +13,11 @@ func SetupTagRoutes(router *mux.Router, tagHandler *handlers.TagHandler, cfg con
 	router.HandleFunc("/api/tags/process", tagHandler.ProcessTags).Methods("POST")
 	router.HandleFunc("/api/tags", tagHandler.GetAllTags).Methods("GET")
 	router.HandleFunc("/api/tags", tagHandler.UpdateTag).Methods("PUT")
+	router.HandleFunc("/api/tags/{id:[0-9]+}", tagHandler.UpdateTag).Methods("PUT")
 	router.HandleFunc("/api/tags/search", tagHandler.SearchTags).Methods("GET")
+	router.HandleFunc("/api/tags/suggest", tagHandler.SuggestTags).Methods("GET")
+
+	// Подписки на теги для домашней ленты
+	router.Handle("/api/tags/{id:[0-9]+}/subscribe", middleware.AuthMiddleware(cfg)(http.HandlerFunc(tagHandler.SubscribeTag))).Methods("POST")
+	router.Handle("/api/tags/{id:[0-9]+}/unsubscribe", middleware.AuthMiddleware(cfg)(http.HandlerFunc(tagHandler.UnsubscribeTag))).Methods("DELETE")
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"net/http"
+	"pornterest/internal/config"
+	"pornterest/internal/handlers"
+	"pornterest/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupUploadRoutes регистрирует маршруты возобновляемой загрузки (tus)
+func SetupUploadRoutes(router *mux.Router, uploadHandler *handlers.ResumableUploadHandler, cfg config.Config) {
+	router.HandleFunc("/api/uploads", uploadHandler.Options).Methods("OPTIONS")
+	router.Handle("/api/uploads", middleware.AuthMiddleware(cfg)(http.HandlerFunc(uploadHandler.CreateUpload))).Methods("POST")
+	router.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(uploadHandler.GetUploadOffset))).Methods("HEAD")
+	router.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(uploadHandler.PatchUpload))).Methods("PATCH")
+	router.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.AuthMiddleware(cfg)(http.HandlerFunc(uploadHandler.DeleteUpload))).Methods("DELETE")
+}
@@ -18,7 +18,7 @@ func protectedHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // SetupUserRoutes регистрирует маршруты, связанные с пользователями
-func SetupUserRoutes(router *mux.Router, userHandler *handlers.UserHandler, subscriptionHandler *handlers.SubscriptionHandler, cfg config.Config) {
+func SetupUserRoutes(router *mux.Router, userHandler *handlers.UserHandler, subscriptionHandler *handlers.SubscriptionHandler, blockHandler *handlers.BlockHandler, cfg config.Config) {
 	router.HandleFunc("/api/register", userHandler.Register).Methods("POST")
 	router.HandleFunc("/api/login", userHandler.Login).Methods("POST")
 	router.Handle("/api/protected", middleware.AuthMiddleware(cfg)(http.HandlerFunc(protectedHandler))).Methods("GET")
@@ -32,4 +32,8 @@ func SetupUserRoutes(router *mux.Router, userHandler *handlers.UserHandler, subs
 	router.Handle("/api/users/{target_user_id:[0-9]+}/subscribe", middleware.AuthMiddleware(cfg)(http.HandlerFunc(subscriptionHandler.SubscribeUser))).Methods("POST")
 	router.Handle("/api/users/{target_user_id:[0-9]+}/unsubscribe", middleware.AuthMiddleware(cfg)(http.HandlerFunc(subscriptionHandler.UnsubscribeUser))).Methods("DELETE")
 	router.Handle("/api/users/{target_user_id:[0-9]+}/subscribed", middleware.AuthMiddleware(cfg)(http.HandlerFunc(subscriptionHandler.CheckIfSubscribed))).Methods("GET")
+
+	// Маршруты для блокировок
+	router.Handle("/api/users/{target_user_id:[0-9]+}/block", middleware.AuthMiddleware(cfg)(http.HandlerFunc(blockHandler.BlockUser))).Methods("POST")
+	router.Handle("/api/users/{target_user_id:[0-9]+}/unblock", middleware.AuthMiddleware(cfg)(http.HandlerFunc(blockHandler.UnblockUser))).Methods("DELETE")
 }
@@ -0,0 +1,129 @@
+// Package searchql разбирает язык поисковых запросов в стиле имиджбордов:
+//
+//	cat "black cat" tag:kitten -tag:dog (tag:red OR tag:blue) type:video ai:false width:>1000 user:alice sort:new
+//
+// Слова без префикса ищутся по тексту, фразы в кавычках — целиком, tag: требует тег,
+// минус исключает терм, OR объединяет соседние термы, скобки группируют
+package searchql
+
+// Node — узел разобранного запроса
+type Node interface {
+	node()
+}
+
+// And — все дочерние узлы должны совпасть
+type And struct {
+	Nodes []Node
+}
+
+// Or — должен совпасть хотя бы один дочерний узел
+type Or struct {
+	Nodes []Node
+}
+
+// Not исключает совпадения узла
+type Not struct {
+	Node Node
+}
+
+// Text — слово для полнотекстового поиска
+type Text struct {
+	Value string
+}
+
+// Phrase — фраза в кавычках, слова должны идти подряд
+type Phrase struct {
+	Value string
+}
+
+// Tag — тег по title_model или названию на любом языке
+type Tag struct {
+	Name string
+}
+
+// Type — тип медиа: image, gif или video
+type Type struct {
+	Value string
+}
+
+// User — автор пина по никнейму
+type User struct {
+	Nickname string
+}
+
+// AI — признак сгенерированного нейросетью контента
+type AI struct {
+	Value bool
+}
+
+// Range — ограничение числового поля: width, height или duration. Nil-граница не ограничивает
+type Range struct {
+	Field        string
+	Min          *float64
+	Max          *float64
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+func (And) node()    {}
+func (Or) node()     {}
+func (Not) node()    {}
+func (Text) node()   {}
+func (Phrase) node() {}
+func (Tag) node()    {}
+func (Type) node()   {}
+func (User) node()   {}
+func (AI) node()     {}
+func (Range) node()  {}
+
+// Порядок выдачи, задаваемый ключевым словом sort: или параметром sort
+const (
+	SortRelevance = "relevance"
+	SortNew       = "new"
+	SortLikes     = "likes"
+	SortSaves     = "saves"
+	// SortTrending — вовлеченность с затуханием по возрасту пина
+	SortTrending = "trending"
+)
+
+// SortValues — допустимые значения sort:
+var SortValues = []string{SortRelevance, SortNew, SortLikes, SortSaves, SortTrending}
+
+// Query — разобранный запрос
+type Query struct {
+	// Root — условие отбора; nil, если запрос пустой или состоит только из sort:
+	Root Node
+	// Sort — порядок из sort:, пустая строка если не задан
+	Sort string
+}
+
+// Users возвращает никнеймы всех авторов, упомянутых в запросе
+func (q *Query) Users() []string {
+	var nicknames []string
+	Walk(q.Root, func(n Node) {
+		if u, ok := n.(User); ok {
+			nicknames = append(nicknames, u.Nickname)
+		}
+	})
+	return nicknames
+}
+
+// Walk обходит дерево в глубину, вызывая fn для каждого узла
+func Walk(n Node, fn func(Node)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	switch n := n.(type) {
+	case And:
+		for _, child := range n.Nodes {
+			Walk(child, fn)
+		}
+	case Or:
+		for _, child := range n.Nodes {
+			Walk(child, fn)
+		}
+	case Not:
+		Walk(n.Node, fn)
+	}
+}
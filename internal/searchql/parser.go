@@ -0,0 +1,436 @@
+package searchql
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxQueryLength — запросы длиннее не разбираются, чтобы не строить огромные запросы к индексу
+const MaxQueryLength = 1000
+
+// SyntaxError — ошибка разбора с позицией (в символах от начала запроса, с нуля)
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokTerm
+	tokNot
+	tokOr
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	// field — префикс до двоеточия у известных полей, иначе пустой
+	field  string
+	value  string
+	quoted bool
+	// valuePos — позиция значения после префикса поля
+	valuePos int
+}
+
+// fields — префиксы, которые разбираются как ключевые слова. Остальные слова с двоеточием — обычный текст
+var fields = map[string]bool{
+	"tag":      true,
+	"type":     true,
+	"user":     true,
+	"ai":       true,
+	"width":    true,
+	"height":   true,
+	"duration": true,
+	"sort":     true,
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	switch c := l.input[l.pos]; {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, pos: start}, nil
+	case c == '|':
+		l.pos++
+		return token{kind: tokOr, pos: start}, nil
+	case c == '-':
+		l.pos++
+		if l.pos >= len(l.input) || unicode.IsSpace(l.input[l.pos]) || l.input[l.pos] == ')' {
+			return token{}, &SyntaxError{Pos: start, Msg: "expected a term after '-'"}
+		}
+		return token{kind: tokNot, pos: start}, nil
+	case c == '"':
+		value, err := l.quoted()
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokTerm, pos: start, value: value, quoted: true, valuePos: start}, nil
+	}
+
+	word := l.word()
+	if word == "OR" {
+		return token{kind: tokOr, pos: start}, nil
+	}
+
+	tok := token{kind: tokTerm, pos: start, value: word, valuePos: start}
+	if i := strings.IndexRune(word, ':'); i > 0 {
+		field := strings.ToLower(word[:i])
+		if fields[field] {
+			tok.field = field
+			tok.value = word[i+1:]
+			tok.valuePos = start + len([]rune(word[:i+1]))
+			// tag:"black cat" — значение в кавычках сразу после двоеточия
+			if tok.value == "" && l.pos < len(l.input) && l.input[l.pos] == '"' {
+				value, err := l.quoted()
+				if err != nil {
+					return token{}, err
+				}
+				tok.value = value
+				tok.quoted = true
+			}
+		}
+	}
+	return tok, nil
+}
+
+// word читает слово до пробела, скобки или кавычки
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if unicode.IsSpace(c) || c == '(' || c == ')' || c == '"' {
+			break
+		}
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+// quoted читает строку в кавычках; \" и \\ внутри экранируют символ
+func (l *lexer) quoted() (string, error) {
+	start := l.pos
+	l.pos++ // открывающая кавычка
+
+	var b strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.input):
+			b.WriteRune(l.input[l.pos+1])
+			l.pos += 2
+		case c == '"':
+			l.pos++
+			return b.String(), nil
+		default:
+			b.WriteRune(c)
+			l.pos++
+		}
+	}
+	return "", &SyntaxError{Pos: start, Msg: "unterminated quote"}
+}
+
+type parser struct {
+	lex  lexer
+	tok  token
+	sort string
+}
+
+// Parse разбирает запрос. Пустой запрос — не ошибка, у него Root == nil
+func Parse(input string) (*Query, error) {
+	if len([]rune(input)) > MaxQueryLength {
+		return nil, &SyntaxError{Pos: MaxQueryLength, Msg: fmt.Sprintf("query is longer than %d characters", MaxQueryLength)}
+	}
+
+	p := &parser{lex: lexer{input: []rune(input)}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseAnd(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokRParen {
+		return nil, &SyntaxError{Pos: p.tok.pos, Msg: "unexpected ')'"}
+	}
+
+	return &Query{Root: root, Sort: p.sort}, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// parseAnd читает последовательность термов до конца запроса или закрывающей скобки
+func (p *parser) parseAnd(depth int) (Node, error) {
+	var nodes []Node
+	for p.tok.kind != tokEOF && p.tok.kind != tokRParen {
+		n, err := p.parseOr(depth)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	default:
+		return And{Nodes: nodes}, nil
+	}
+}
+
+// parseOr читает термы, соединенные OR: OR связывает сильнее, чем пробел
+func (p *parser) parseOr(depth int) (Node, error) {
+	if p.tok.kind == tokOr {
+		return nil, &SyntaxError{Pos: p.tok.pos, Msg: "OR must be between two terms"}
+	}
+
+	firstPos := p.tok.pos
+	first, err := p.parseUnary(depth, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOr {
+		return first, nil
+	}
+	if first == nil {
+		// Первым термом был sort: — он не может участвовать в OR
+		return nil, &SyntaxError{Pos: firstPos, Msg: "sort: must be a top-level term"}
+	}
+
+	nodes := []Node{first}
+	for p.tok.kind == tokOr {
+		orPos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokEOF || p.tok.kind == tokRParen || p.tok.kind == tokOr {
+			return nil, &SyntaxError{Pos: orPos, Msg: "OR must be between two terms"}
+		}
+		n, err := p.parseUnary(depth, true)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+// parseUnary читает терм с необязательным минусом. nested — терм внутри OR или отрицания
+func (p *parser) parseUnary(depth int, nested bool) (Node, error) {
+	if p.tok.kind != tokNot {
+		return p.parsePrimary(depth, nested)
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseUnary(depth, true)
+	if err != nil {
+		return nil, err
+	}
+	return Not{Node: n}, nil
+}
+
+func (p *parser) parsePrimary(depth int, nested bool) (Node, error) {
+	switch p.tok.kind {
+	case tokLParen:
+		openPos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		n, err := p.parseAnd(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, &SyntaxError{Pos: openPos, Msg: "missing closing parenthesis"}
+		}
+		if n == nil {
+			return nil, &SyntaxError{Pos: openPos, Msg: "empty group"}
+		}
+		return n, p.advance()
+	case tokRParen:
+		return nil, &SyntaxError{Pos: p.tok.pos, Msg: "unexpected ')'"}
+	case tokOr:
+		return nil, &SyntaxError{Pos: p.tok.pos, Msg: "OR must be between two terms"}
+	}
+
+	tok := p.tok
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if tok.field == "sort" {
+		if depth > 0 || nested {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "sort: must be a top-level term"}
+		}
+		if p.sort != "" {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "sort: is specified more than once"}
+		}
+		if !slices.Contains(SortValues, tok.value) {
+			return nil, &SyntaxError{Pos: tok.valuePos, Msg: fmt.Sprintf("unknown sort %q, expected one of: %s", tok.value, strings.Join(SortValues, ", "))}
+		}
+		p.sort = tok.value
+		return nil, nil
+	}
+
+	return termNode(tok)
+}
+
+// termNode превращает терм в узел, проверяя значение ключевого слова
+func termNode(tok token) (Node, error) {
+	if tok.field == "" {
+		if tok.quoted {
+			if strings.TrimSpace(tok.value) == "" {
+				return nil, &SyntaxError{Pos: tok.pos, Msg: "empty phrase"}
+			}
+			return Phrase{Value: tok.value}, nil
+		}
+		return Text{Value: tok.value}, nil
+	}
+
+	if tok.value == "" {
+		return nil, &SyntaxError{Pos: tok.valuePos, Msg: fmt.Sprintf("expected a value after '%s:'", tok.field)}
+	}
+	valueErr := func(msg string) error {
+		return &SyntaxError{Pos: tok.valuePos, Msg: msg}
+	}
+
+	switch tok.field {
+	case "tag":
+		return Tag{Name: tok.value}, nil
+	case "user":
+		return User{Nickname: tok.value}, nil
+	case "type":
+		value := strings.ToLower(tok.value)
+		if value != "image" && value != "gif" && value != "video" {
+			return nil, valueErr(fmt.Sprintf("unknown type %q, expected image, gif or video", tok.value))
+		}
+		return Type{Value: value}, nil
+	case "ai":
+		switch strings.ToLower(tok.value) {
+		case "true", "yes", "1":
+			return AI{Value: true}, nil
+		case "false", "no", "0":
+			return AI{Value: false}, nil
+		}
+		return nil, valueErr(fmt.Sprintf("invalid ai value %q, expected true or false", tok.value))
+	default: // width, height, duration
+		r, err := parseRange(tok.field, tok.value)
+		if err != nil {
+			return nil, valueErr(err.Error())
+		}
+		return r, nil
+	}
+}
+
+// parseRange разбирает сравнение: >N, >=N, <N, <=N, =N, N, N..M, N.. или ..M
+func parseRange(field, value string) (Range, error) {
+	r := Range{Field: field}
+	integer := field != "duration"
+
+	number := func(s string) (*float64, error) {
+		var v float64
+		var err error
+		if integer {
+			var n int
+			n, err = strconv.Atoi(s)
+			v = float64(n)
+		} else {
+			v, err = strconv.ParseFloat(s, 64)
+		}
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid %s value %q", field, value)
+		}
+		return &v, nil
+	}
+
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		if lo == "" && hi == "" {
+			return r, fmt.Errorf("invalid %s range %q", field, value)
+		}
+		var err error
+		if lo != "" {
+			if r.Min, err = number(lo); err != nil {
+				return r, err
+			}
+		}
+		if hi != "" {
+			if r.Max, err = number(hi); err != nil {
+				return r, err
+			}
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return r, fmt.Errorf("empty %s range %q", field, value)
+		}
+		return r, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		rest, ok := strings.CutPrefix(value, op)
+		if !ok {
+			continue
+		}
+		v, err := number(rest)
+		if err != nil {
+			return r, err
+		}
+		switch op {
+		case ">=":
+			r.Min = v
+		case "<=":
+			r.Max = v
+		case ">":
+			r.Min, r.MinExclusive = v, true
+		case "<":
+			r.Max, r.MaxExclusive = v, true
+		case "=":
+			r.Min, r.Max = v, v
+		}
+		return r, nil
+	}
+
+	v, err := number(value)
+	if err != nil {
+		return r, err
+	}
+	r.Min, r.Max = v, v
+	return r, nil
+}
@@ -0,0 +1,222 @@
+package searchql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func num(v float64) *float64 {
+	return &v
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Node
+		sort  string
+	}{
+		{
+			name:  "empty",
+			input: "   ",
+			want:  nil,
+		},
+		{
+			name:  "single word",
+			input: "cat",
+			want:  Text{Value: "cat"},
+		},
+		{
+			name:  "words are joined with and",
+			input: "black cat",
+			want:  And{Nodes: []Node{Text{Value: "black"}, Text{Value: "cat"}}},
+		},
+		{
+			name:  "include and exclude tags",
+			input: "tag:cat -tag:dog",
+			want:  And{Nodes: []Node{Tag{Name: "cat"}, Not{Node: Tag{Name: "dog"}}}},
+		},
+		{
+			name:  "quoted phrase",
+			input: `"black cat" sleeping`,
+			want:  And{Nodes: []Node{Phrase{Value: "black cat"}, Text{Value: "sleeping"}}},
+		},
+		{
+			name:  "escaped quote inside phrase",
+			input: `"say \"meow\""`,
+			want:  Phrase{Value: `say "meow"`},
+		},
+		{
+			name:  "quoted tag value",
+			input: `tag:"black cat"`,
+			want:  Tag{Name: "black cat"},
+		},
+		{
+			name:  "or binds tighter than and",
+			input: "tag:red OR tag:blue cat",
+			want: And{Nodes: []Node{
+				Or{Nodes: []Node{Tag{Name: "red"}, Tag{Name: "blue"}}},
+				Text{Value: "cat"},
+			}},
+		},
+		{
+			name:  "pipe is or",
+			input: "cat | dog",
+			want:  Or{Nodes: []Node{Text{Value: "cat"}, Text{Value: "dog"}}},
+		},
+		{
+			name:  "negated group",
+			input: "cat -(tag:dog OR tag:fox)",
+			want: And{Nodes: []Node{
+				Text{Value: "cat"},
+				Not{Node: Or{Nodes: []Node{Tag{Name: "dog"}, Tag{Name: "fox"}}}},
+			}},
+		},
+		{
+			name:  "nested groups",
+			input: "(a (b OR c))",
+			want: And{Nodes: []Node{
+				Text{Value: "a"},
+				Or{Nodes: []Node{Text{Value: "b"}, Text{Value: "c"}}},
+			}},
+		},
+		{
+			name:  "keywords",
+			input: "type:Video ai:false user:alice",
+			want: And{Nodes: []Node{
+				Type{Value: "video"},
+				AI{Value: false},
+				User{Nickname: "alice"},
+			}},
+		},
+		{
+			name:  "field names are case insensitive",
+			input: "TAG:cat",
+			want:  Tag{Name: "cat"},
+		},
+		{
+			name:  "unknown field is text",
+			input: "re:zero",
+			want:  Text{Value: "re:zero"},
+		},
+		{
+			name:  "hyphen inside word",
+			input: "t-shirt",
+			want:  Text{Value: "t-shirt"},
+		},
+		{
+			name:  "greater than",
+			input: "width:>1000",
+			want:  Range{Field: "width", Min: num(1000), MinExclusive: true},
+		},
+		{
+			name:  "less or equal",
+			input: "height:<=720",
+			want:  Range{Field: "height", Max: num(720)},
+		},
+		{
+			name:  "exact value",
+			input: "width:1920",
+			want:  Range{Field: "width", Min: num(1920), Max: num(1920)},
+		},
+		{
+			name:  "closed range",
+			input: "duration:2.5..30",
+			want:  Range{Field: "duration", Min: num(2.5), Max: num(30)},
+		},
+		{
+			name:  "open range",
+			input: "width:..800",
+			want:  Range{Field: "width", Max: num(800)},
+		},
+		{
+			name:  "sort is not a node",
+			input: "cat sort:new",
+			want:  Text{Value: "cat"},
+			sort:  SortNew,
+		},
+		{
+			name:  "sort only",
+			input: "sort:new",
+			want:  nil,
+			sort:  SortNew,
+		},
+		{
+			name:  "cyrillic",
+			input: "кошка -tag:собака",
+			want:  And{Nodes: []Node{Text{Value: "кошка"}, Not{Node: Tag{Name: "собака"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(q.Root, tt.want) {
+				t.Errorf("Parse(%q).Root = %#v, want %#v", tt.input, q.Root, tt.want)
+			}
+			if q.Sort != tt.sort {
+				t.Errorf("Parse(%q).Sort = %q, want %q", tt.input, q.Sort, tt.sort)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{input: `cat "black`, pos: 4},
+		{input: "cat (dog", pos: 4},
+		{input: "cat )", pos: 4},
+		{input: "()", pos: 0},
+		{input: "OR cat", pos: 0},
+		{input: "cat OR", pos: 4},
+		{input: "cat OR OR dog", pos: 4},
+		{input: "cat -", pos: 4},
+		{input: "cat - dog", pos: 4},
+		{input: "type:audio", pos: 5},
+		{input: "ai:maybe", pos: 3},
+		{input: "tag:", pos: 4},
+		{input: "width:>abc", pos: 6},
+		{input: "width:-5", pos: 6},
+		{input: "width:10.5", pos: 6},
+		{input: "width:900..100", pos: 6},
+		{input: "width:..", pos: 6},
+		{input: "sort:random", pos: 5},
+		{input: "sort:new sort:new", pos: 9},
+		{input: "(cat sort:new)", pos: 5},
+		{input: "-sort:new", pos: 1},
+		{input: "sort:new OR cat", pos: 0},
+		{input: `кот "`, pos: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%q) error = %v, want *SyntaxError", tt.input, err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("Parse(%q) error position = %d (%v), want %d", tt.input, syntaxErr.Pos, syntaxErr, tt.pos)
+			}
+		})
+	}
+}
+
+func TestQueryUsers(t *testing.T) {
+	q, err := Parse("user:alice (cat OR user:bob) -user:carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := q.Users()
+	want := []string{"alice", "bob", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Users() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package searchql
+
+// Words возвращает слова свободного текста, без которых запрос остается осмысленным:
+// слова верхнего уровня, не под отрицанием и не внутри OR. Повторы не возвращаются
+func (q *Query) Words() []string {
+	var words []string
+	seen := make(map[string]bool)
+	add := func(n Node) {
+		if t, ok := n.(Text); ok && !seen[t.Value] {
+			seen[t.Value] = true
+			words = append(words, t.Value)
+		}
+	}
+
+	switch root := q.Root.(type) {
+	case Text:
+		add(root)
+	case And:
+		for _, child := range root.Nodes {
+			add(child)
+		}
+	}
+	return words
+}
+
+// WithoutWords возвращает копию запроса без указанных слов из Words. Остальные условия не меняются
+func (q *Query) WithoutWords(drop []string) *Query {
+	dropped := make(map[string]bool, len(drop))
+	for _, w := range drop {
+		dropped[w] = true
+	}
+	isDropped := func(n Node) bool {
+		t, ok := n.(Text)
+		return ok && dropped[t.Value]
+	}
+
+	relaxed := &Query{Root: q.Root, Sort: q.Sort}
+	switch root := q.Root.(type) {
+	case Text:
+		if isDropped(root) {
+			relaxed.Root = nil
+		}
+	case And:
+		var nodes []Node
+		for _, child := range root.Nodes {
+			if !isDropped(child) {
+				nodes = append(nodes, child)
+			}
+		}
+		switch len(nodes) {
+		case 0:
+			relaxed.Root = nil
+		case 1:
+			relaxed.Root = nodes[0]
+		default:
+			relaxed.Root = And{Nodes: nodes}
+		}
+	}
+	return relaxed
+}
@@ -0,0 +1,72 @@
+package searchql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "cat", want: []string{"cat"}},
+		{input: "black cat black", want: []string{"black", "cat"}},
+		{input: `red "big cat" -dog (fox OR wolf) tag:kitten`, want: []string{"red"}},
+		{input: "tag:kitten", want: nil},
+		{input: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		if got := q.Words(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q).Words() = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWithoutWords(t *testing.T) {
+	tests := []struct {
+		input string
+		drop  []string
+		want  Node
+	}{
+		{
+			input: "fluffy black cat",
+			drop:  []string{"fluffy"},
+			want:  And{Nodes: []Node{Text{Value: "black"}, Text{Value: "cat"}}},
+		},
+		{
+			input: "fluffy cat tag:kitten",
+			drop:  []string{"fluffy", "cat"},
+			want:  Tag{Name: "kitten"},
+		},
+		{
+			input: "cat",
+			drop:  []string{"cat"},
+			want:  nil,
+		},
+		{
+			input: "cat -cat",
+			drop:  []string{"cat"},
+			want:  Not{Node: Text{Value: "cat"}},
+		},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.input + " sort:new")
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		relaxed := q.WithoutWords(tt.drop)
+		if !reflect.DeepEqual(relaxed.Root, tt.want) {
+			t.Errorf("Parse(%q).WithoutWords(%v).Root = %#v, want %#v", tt.input, tt.drop, relaxed.Root, tt.want)
+		}
+		if relaxed.Sort != SortNew {
+			t.Errorf("WithoutWords dropped sort: got %q", relaxed.Sort)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Handler отдает объекты хранилища по HTTP. Путь запроса (без префикса) используется как ключ
+func Handler(store Storage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if key == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		obj, info, err := store.Get(r.Context(), key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			log.Printf("Failed to read media %s: %v", key, err)
+			http.Error(w, "Failed to read media", http.StatusInternalServerError)
+			return
+		}
+		defer obj.Close()
+
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+
+		if rs, ok := obj.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, key, info.ModTime, rs)
+			return
+		}
+
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, obj); err != nil {
+			log.Printf("Failed to send media %s: %v", key, err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"pornterest/internal/config"
+)
+
+// ErrNotFound возвращается, когда объекта с указанным ключом нет в хранилище
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo описывает сохраненный объект
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage абстрагирует хранилище медиафайлов. Ключи — относительные пути вида "12_1700000000.jpg"
+type Storage interface {
+	// Put сохраняет объект. size может быть -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект на чтение. Вызывающий обязан закрыть reader
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete удаляет объект. Отсутствие объекта ошибкой не считается
+	Delete(ctx context.Context, key string) error
+	// Stat возвращает информацию об объекте или ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// URL возвращает публичный адрес объекта
+	URL(key string) string
+	// List вызывает fn для каждого объекта хранилища; ошибка fn прерывает обход
+	List(ctx context.Context, fn func(ObjectInfo) error) error
+}
+
+// New создает хранилище согласно конфигурации
+func New(cfg config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		return NewLocalStorage(cfg.StorageLocalDir, cfg.PublicMediaURL)
+	case "s3":
+		return NewS3Storage(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			UseSSL:    cfg.S3UseSSL,
+			BaseURL:   cfg.PublicMediaURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// KeyFromPath возвращает ключ объекта по значению pins.path. Старые записи хранят
+// абсолютный URL вида "http://host/upload/<key>", новые — только ключ
+func KeyFromPath(path string) string {
+	if !strings.Contains(path, "://") {
+		return path
+	}
+	idx := strings.Index(path, "/upload/")
+	if idx == -1 {
+		return ""
+	}
+	return path[idx+len("/upload/"):]
+}
+
+// PublicURL строит публичный адрес медиафайла по значению pins.path
+func PublicURL(store Storage, path string) string {
+	if path == "" {
+		return ""
+	}
+	key := KeyFromPath(path)
+	if key == "" {
+		return path
+	}
+	return store.URL(key)
+}
@@ -0,0 +1,63 @@
+// Package tagsuggest поддерживает индекс подсказок тегов и готовит строки автодополнения
+package tagsuggest
+
+import "strings"
+
+// Клавиши латинской раскладки QWERTY и русской ЙЦУКЕН в одинаковом порядке
+const (
+	latinKeys    = "qwertyuiop[]asdfghjkl;'zxcvbnm,.`"
+	cyrillicKeys = "йцукенгшщзхъфывапролджэячсмитьбюё"
+)
+
+var latinToCyrillic, cyrillicToLatin = buildLayoutMaps()
+
+func buildLayoutMaps() (map[rune]rune, map[rune]rune) {
+	latin := []rune(latinKeys)
+	cyrillic := []rune(cyrillicKeys)
+	toCyrillic := make(map[rune]rune, len(latin))
+	toLatin := make(map[rune]rune, len(latin))
+	for i := range latin {
+		toCyrillic[latin[i]] = cyrillic[i]
+		toLatin[cyrillic[i]] = latin[i]
+	}
+	return toCyrillic, toLatin
+}
+
+// SwitchLayout переводит строку, набранную не в той раскладке: "rjirf" -> "кошка", "ьщгыу" -> "mouse".
+// Направление выбирается по первой букве; ok=false, если переводить нечего
+func SwitchLayout(s string) (string, bool) {
+	s = strings.ToLower(s)
+
+	var table map[rune]rune
+	for _, r := range s {
+		if _, found := latinToCyrillic[r]; found && r >= 'a' && r <= 'z' {
+			table = latinToCyrillic
+			break
+		}
+		if _, found := cyrillicToLatin[r]; found {
+			table = cyrillicToLatin
+			break
+		}
+	}
+	if table == nil {
+		return "", false
+	}
+
+	switched := strings.Map(func(r rune) rune {
+		if mapped, found := table[r]; found {
+			return mapped
+		}
+		return r
+	}, s)
+	return switched, switched != s
+}
+
+// Variants возвращает строку автодополнения и ее вариант в другой раскладке, если он есть
+func Variants(q string) []string {
+	q = strings.TrimSpace(q)
+	variants := []string{q}
+	if switched, ok := SwitchLayout(q); ok {
+		variants = append(variants, switched)
+	}
+	return variants
+}
@@ -0,0 +1,94 @@
+package tagsuggest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// syncBatchSize — сколько тегов индексируется за один проход
+const syncBatchSize = 500
+
+// Syncer переносит в индекс подсказок теги, изменившиеся после последней индексации.
+// Любое изменение тега (создание, перевод, счетчик) сдвигает updated_at, поэтому отдельных событий не нужно
+type Syncer struct {
+	db     *gorm.DB
+	es     *elasticsearch.ESClient
+	logger *slog.Logger
+}
+
+func NewSyncer(db *gorm.DB, es *elasticsearch.ESClient, logger *slog.Logger) *Syncer {
+	return &Syncer{
+		db:     db,
+		es:     es,
+		logger: logger,
+	}
+}
+
+// Start запускает фоновую синхронизацию с заданным интервалом
+func (s *Syncer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				synced, err := s.SyncBatch(context.Background())
+				if err != nil {
+					s.logger.Error("failed to sync tag suggestions", "error", err)
+					break
+				}
+				if synced < syncBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// SyncBatch индексирует очередную порцию изменившихся тегов и возвращает их количество
+func (s *Syncer) SyncBatch(ctx context.Context) (int, error) {
+	var tags []models.Tag
+	if err := s.db.
+		Where("indexed_at IS NULL OR indexed_at < updated_at").
+		Order("updated_at ASC").
+		Limit(syncBatchSize).
+		Find(&tags).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch changed tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return 0, nil
+	}
+
+	if err := IndexTags(ctx, s.db, s.es, tags); err != nil {
+		return 0, err
+	}
+	return len(tags), nil
+}
+
+// IndexTags индексирует теги и отмечает их проиндексированными на момент прочитанного updated_at:
+// если тег изменится во время индексации, он попадет в следующий проход
+func IndexTags(ctx context.Context, db *gorm.DB, es *elasticsearch.ESClient, tags []models.Tag) error {
+	docs := make([]elasticsearch.TagSuggestDocument, len(tags))
+	for i := range tags {
+		docs[i] = elasticsearch.NewTagSuggestDocument(&tags[i])
+	}
+	if err := es.BulkIndexTags(ctx, docs); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := db.Table("tags").
+			Where("id = ?", tag.ID).
+			Update("indexed_at", tag.UpdatedAt).Error; err != nil {
+			return fmt.Errorf("failed to mark tag %d as indexed: %w", tag.ID, err)
+		}
+	}
+	return nil
+}
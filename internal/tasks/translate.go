@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"pornterest/internal/models"
+	"pornterest/internal/outbox"
 
 	"gorm.io/gorm"
 )
@@ -59,7 +60,7 @@ func (t *TaskQueue) ProcessTranslationTasks() {
 			continue
 		}
 
-		translatedText, err := translateText(tag.TitleEN)
+		translatedText, err := TranslateText(tag.TitleEN)
 		if err != nil {
 			t.logger.Error("failed to translate tag",
 				"error", err,
@@ -71,7 +72,14 @@ func (t *TaskQueue) ProcessTranslationTasks() {
 
 		tag.TitleRU = translatedText // Обратите внимание на изменение TitleRu на TitleRU
 		tag.UpdatedAt = time.Now()
-		if err := t.db.Save(&tag).Error; err != nil {
+		// Русское название попадает в документы пинов с этим тегом, поэтому они переиндексируются
+		err = t.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&tag).Error; err != nil {
+				return err
+			}
+			return outbox.EnqueueTagPins(tx, tag.ID)
+		})
+		if err != nil {
 			t.logger.Error("failed to update tag",
 				"error", err,
 				"tag_id", task.TagID,
@@ -89,7 +97,8 @@ func (t *TaskQueue) ProcessTranslationTasks() {
 	}
 }
 
-func translateText(text string) (string, error) {
+// TranslateText переводит текст на русский через Yandex Translate
+func TranslateText(text string) (string, error) {
 	const (
 		endpoint = "https://translate.api.cloud.yandex.net/translate/v2/translate"
 	)
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pornterest/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// CreateAdmin выдает права администратора пользователю с указанным email.
+// Если такого пользователя нет, создает его с паролем password. В режиме dryRun только сообщает, что будет сделано
+func CreateAdmin(db *gorm.DB, email, nickname, password string, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if email == "" {
+		return fmt.Errorf("email is required")
+	}
+
+	var user models.User
+	err := db.Where("email = ?", email).First(&user).Error
+	if err == nil {
+		if user.Admin {
+			log.Printf("User %d (%s) is already an admin", user.ID, email)
+			return nil
+		}
+		log.Printf("Granting admin rights to user %d (%s)", user.ID, email)
+		if dryRun {
+			return nil
+		}
+		if err := db.Model(&user).Updates(map[string]interface{}{"admin": true, "updated_at": time.Now()}).Error; err != nil {
+			return fmt.Errorf("failed to update user: %v", err)
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	if nickname == "" || password == "" {
+		return fmt.Errorf("user %s does not exist: nickname and password are required to create it", email)
+	}
+
+	var taken int64
+	if err := db.Model(&models.User{}).Where("nickname = ?", nickname).Count(&taken).Error; err != nil {
+		return fmt.Errorf("failed to check nickname: %v", err)
+	}
+	if taken > 0 {
+		return fmt.Errorf("nickname %s is already taken", nickname)
+	}
+
+	log.Printf("Creating admin user %s (%s)", nickname, email)
+	if dryRun {
+		return nil
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	user = models.User{
+		Nickname:  nickname,
+		Email:     email,
+		Password:  string(hashedPassword),
+		Admin:     true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+
+	log.Printf("Created admin user %d", user.ID)
+	return nil
+}
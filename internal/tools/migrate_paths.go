@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"fmt"
+	"log"
+
+	"pornterest/internal/models"
+	"pornterest/internal/outbox"
+	"pornterest/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// MigratePinPaths переписывает pins.path из абсолютных URL ("http://localhost:8080/upload/<key>")
+// в ключи хранилища и ставит измененные пины в outbox на переиндексацию. В режиме dryRun только выводит изменения
+func MigratePinPaths(db *gorm.DB, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	var pins []models.Pin
+	if err := db.Where("path LIKE ?", "%://%").Order("id ASC").Find(&pins).Error; err != nil {
+		return fmt.Errorf("failed to fetch pins: %v", err)
+	}
+
+	log.Printf("Found %d pins with absolute paths", len(pins))
+
+	migrated := 0
+	for _, pin := range pins {
+		currentPin := pin
+
+		key := storage.KeyFromPath(currentPin.Path)
+		if key == "" {
+			log.Printf("Skipping pin %d: cannot extract storage key from %q", currentPin.ID, currentPin.Path)
+			continue
+		}
+
+		log.Printf("Pin %d: %s -> %s", currentPin.ID, currentPin.Path, key)
+		if dryRun {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Pin{}).Where("id = ?", currentPin.ID).Update("path", key).Error; err != nil {
+				return err
+			}
+			return outbox.Enqueue(tx, outbox.EventIndexPin, currentPin.ID)
+		})
+		if err != nil {
+			log.Printf("Failed to update path of pin %d: %v", currentPin.ID, err)
+			continue
+		}
+		migrated++
+	}
+
+	log.Printf("Path migration completed: %d of %d pins migrated", migrated, len(pins))
+	return nil
+}
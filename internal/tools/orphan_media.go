@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"pornterest/internal/models"
+	"pornterest/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// PurgeOrphanMedia удаляет из хранилища объекты, на которые не ссылается ни пин, ни его копия.
+// Объекты моложе minAge пропускаются: загрузка могла сохранить файл, но еще не закоммитить пин.
+// В режиме dryRun только выводит список
+func PurgeOrphanMedia(db *gorm.DB, store storage.Storage, minAge time.Duration, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if store == nil {
+		return fmt.Errorf("media storage is nil")
+	}
+
+	// Список ссылок собираем до обхода хранилища, чтобы новые объекты отсекались по minAge
+	referenced := make(map[string]bool)
+
+	var paths []string
+	if err := db.Model(&models.Pin{}).Pluck("path", &paths).Error; err != nil {
+		return fmt.Errorf("failed to fetch pin paths: %v", err)
+	}
+	for _, path := range paths {
+		if key := storage.KeyFromPath(path); key != "" {
+			referenced[key] = true
+		}
+	}
+
+	var renditionKeys []string
+	if err := db.Model(&models.PinRendition{}).Pluck("key", &renditionKeys).Error; err != nil {
+		return fmt.Errorf("failed to fetch rendition keys: %v", err)
+	}
+	for _, key := range renditionKeys {
+		referenced[key] = true
+	}
+
+	log.Printf("Found %d referenced media objects", len(referenced))
+
+	ctx := context.Background()
+	cutoff := time.Now().Add(-minAge)
+	scanned, orphaned, purged := 0, 0, 0
+	var freed int64
+
+	err := store.List(ctx, func(obj storage.ObjectInfo) error {
+		scanned++
+		if scanned%1000 == 0 {
+			log.Printf("Scanned %d objects, %d orphaned", scanned, orphaned)
+		}
+		if referenced[obj.Key] || obj.ModTime.After(cutoff) {
+			return nil
+		}
+
+		orphaned++
+		log.Printf("Orphan %s (%d bytes, modified %s)", obj.Key, obj.Size, obj.ModTime.Format(time.RFC3339))
+		if dryRun {
+			return nil
+		}
+
+		if err := store.Delete(ctx, obj.Key); err != nil {
+			log.Printf("Failed to delete %s: %v", obj.Key, err)
+			return nil
+		}
+		purged++
+		freed += obj.Size
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list media storage: %v", err)
+	}
+
+	log.Printf("Orphan media purge completed: %d objects scanned, %d orphaned, %d deleted (%d bytes)", scanned, orphaned, purged, freed)
+	return nil
+}
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecountTags пересчитывает tags.count по фактическому количеству связей в pin_tags.
+// В режиме dryRun только выводит расхождения
+func RecountTags(db *gorm.DB, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	var rows []struct {
+		ID         int
+		TitleModel string
+		Count      int
+		Actual     int
+	}
+	if err := db.Raw(`
+		SELECT tags.id, tags.title_model, tags.count, COUNT(pin_tags.id) AS actual
+		FROM tags
+		LEFT JOIN pin_tags ON pin_tags.tag_id = tags.id
+		GROUP BY tags.id
+		HAVING tags.count <> COUNT(pin_tags.id)
+		ORDER BY tags.id`).Scan(&rows).Error; err != nil {
+		return fmt.Errorf("failed to compare tag counts: %v", err)
+	}
+
+	log.Printf("Found %d tags with wrong counts", len(rows))
+
+	fixed := 0
+	for i, row := range rows {
+		log.Printf("[%d/%d] Tag %d (%s): %d -> %d", i+1, len(rows), row.ID, row.TitleModel, row.Count, row.Actual)
+		if dryRun {
+			continue
+		}
+
+		if err := db.Table("tags").Where("id = ?", row.ID).Updates(map[string]interface{}{
+			"count":      row.Actual,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			log.Printf("Failed to update count of tag %d: %v", row.ID, err)
+			continue
+		}
+		fixed++
+	}
+
+	log.Printf("Tag recount completed: %d of %d tags fixed", fixed, len(rows))
+	return nil
+}
@@ -4,14 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"pornterest/internal/elasticsearch"
+	"pornterest/internal/engagement"
 	"pornterest/internal/models"
 
 	"gorm.io/gorm"
 )
 
-func ReindexAllPins(db *gorm.DB, es *elasticsearch.ESClient) error {
+const (
+	// reindexBatchSize — сколько пинов отправляется в индекс одним запросом Bulk API
+	reindexBatchSize = 500
+	// maxCatchUpAttempts — сколько раз догоняем изменения, пока число документов не сойдется с базой
+	maxCatchUpAttempts = 5
+	// catchUpOverlap — запас на расхождение часов реплик при выборе изменившихся пинов
+	catchUpOverlap = time.Minute
+)
+
+// RebuildPinIndex строит следующую версию индекса пинов (pins_vN) с текущим PinMapping,
+// сверяет количество документов с базой, атомарно переключает на нее алиас pins
+// и удаляет старые версии. Пока индекс строится, API продолжает работать со старой версией.
+// В режиме dryRun только сообщает, что будет сделано
+func RebuildPinIndex(db *gorm.DB, es *elasticsearch.ESClient, dryRun bool) error {
 	if db == nil {
 		return fmt.Errorf("database connection is nil")
 	}
@@ -19,38 +34,255 @@ func ReindexAllPins(db *gorm.DB, es *elasticsearch.ESClient) error {
 		return fmt.Errorf("elasticsearch client is nil")
 	}
 
-	var pins []models.Pin
-	if err := db.Find(&pins).Error; err != nil {
-		return fmt.Errorf("failed to fetch pins: %v", err)
+	ctx := context.Background()
+
+	current, err := es.AliasTargets(ctx, elasticsearch.PinsAlias)
+	if err != nil {
+		return fmt.Errorf("failed to resolve alias: %v", err)
+	}
+	legacy, err := es.LegacyPinIndexExists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check legacy index: %v", err)
+	}
+	versions, err := es.PinIndexVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list index versions: %v", err)
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+	index := elasticsearch.PinIndexName(next)
+
+	var total int64
+	if err := db.Model(&models.Pin{}).Count(&total).Error; err != nil {
+		return fmt.Errorf("failed to count pins: %v", err)
 	}
 
-	log.Printf("Found %d pins to reindex", len(pins))
+	log.Printf("Alias %s points to %v, building %s with %d pins", elasticsearch.PinsAlias, current, index, total)
+	if legacy {
+		log.Printf("Legacy index %s without alias will be replaced", elasticsearch.PinsAlias)
+	}
+	if dryRun {
+		return nil
+	}
 
-	for _, pin := range pins {
-		// Создаем копию pin для безопасной передачи указателя
-		currentPin := pin
+	started := time.Now().Add(-catchUpOverlap)
+	if err := es.CreateIndex(ctx, index); err != nil {
+		return fmt.Errorf("failed to create index %s: %v", index, err)
+	}
 
-		// Получаем теги для текущего пина
-		var tags []models.Tag
-		if err := db.Table("tags").
-			Joins("JOIN pin_tags ON pin_tags.tag_id = tags.id").
-			Where("pin_tags.pin_id = ?", currentPin.ID).
-			Find(&tags).Error; err != nil {
-			log.Printf("Failed to fetch tags for pin %d: %v", currentPin.ID, err)
-			// Продолжаем с пустым списком тегов
-			tags = make([]models.Tag, 0)
+	// Если что-то пойдет не так до переключения алиаса, недостроенный индекс удаляем
+	swapped := false
+	defer func() {
+		if !swapped {
+			if err := es.DeleteIndices(ctx, []string{index}); err != nil {
+				log.Printf("Failed to delete unfinished index %s: %v", index, err)
+			}
 		}
+	}()
 
-		log.Printf("Indexing pin %d with %d tags", currentPin.ID, len(tags))
+	if err := es.SetBulkLoadMode(ctx, index, true); err != nil {
+		return err
+	}
 
-		if err := es.IndexPin(context.Background(), &currentPin, tags); err != nil {
-			log.Printf("Failed to index pin %d: %v", currentPin.ID, err)
-			continue
+	indexed, err := bulkIndexPins(ctx, db, es, index, db.Model(&models.Pin{}), int(total))
+	if err != nil {
+		return err
+	}
+	log.Printf("Indexed %d pins into %s", indexed, index)
+
+	if err := es.SetBulkLoadMode(ctx, index, false); err != nil {
+		return err
+	}
+
+	// Пока индекс строился, API писало изменения только в старую версию. Догоняем их вместе с удалениями,
+	// пока число документов не сойдется с базой: на живой системе пины меняются и во время догонки
+	since := started
+	verified := false
+	for attempt := 1; attempt <= maxCatchUpAttempts && !verified; attempt++ {
+		if since, err = catchUpPinIndex(ctx, db, es, index, since); err != nil {
+			return err
 		}
 
-		log.Printf("Successfully indexed pin %d", currentPin.ID)
+		var expected int64
+		if err := db.Model(&models.Pin{}).Count(&expected).Error; err != nil {
+			return fmt.Errorf("failed to count pins: %v", err)
+		}
+		count, err := es.CountDocuments(ctx, index)
+		if err != nil {
+			return err
+		}
+		if int64(count) == expected {
+			log.Printf("Verified %d documents in %s", count, index)
+			verified = true
+		} else {
+			log.Printf("Document count mismatch after catch-up %d: %s has %d documents, database has %d pins", attempt, index, count, expected)
+		}
+	}
+	if !verified {
+		return fmt.Errorf("document count of %s did not converge with the database after %d catch-ups", index, maxCatchUpAttempts)
+	}
+
+	if err := es.SwapAlias(ctx, elasticsearch.PinsAlias, index, current, legacy); err != nil {
+		return fmt.Errorf("failed to swap alias: %v", err)
+	}
+	swapped = true
+	log.Printf("Alias %s now points to %s", elasticsearch.PinsAlias, index)
+
+	// Изменения, записанные в старую версию между последней догонкой и переключением, переносим
+	// уже после него: новые записи API теперь идут в новую версию, старую можно удалять
+	if _, err := catchUpPinIndex(ctx, db, es, index, since); err != nil {
+		return fmt.Errorf("failed to catch up after alias swap, old indices are kept: %v", err)
+	}
+
+	var old []string
+	for _, version := range versions {
+		old = append(old, elasticsearch.PinIndexName(version))
+	}
+	if err := es.DeleteIndices(ctx, old); err != nil {
+		return fmt.Errorf("failed to delete old indices: %v", err)
+	}
+	if len(old) > 0 {
+		log.Printf("Deleted old indices %v", old)
 	}
 
-	log.Printf("Reindexing completed")
 	return nil
 }
+
+// catchUpPinIndex переиндексирует пины, изменившиеся с since, и удаляет из индекса пины, которых больше нет в базе.
+// Возвращает отметку для следующей догонки
+func catchUpPinIndex(ctx context.Context, db *gorm.DB, es *elasticsearch.ESClient, index string, since time.Time) (time.Time, error) {
+	// updated_at назначают реплики API по своим часам — берем отметку с запасом на их расхождение
+	next := time.Now().Add(-catchUpOverlap)
+
+	// Кроме самих пинов меняются их счетчики и названия тегов — это тоже изменения документа
+	changed := db.Model(&models.Pin{}).Where(
+		"updated_at >= ? OR stats_changed_at >= ? OR id IN (SELECT pin_tags.pin_id FROM pin_tags JOIN tags ON tags.id = pin_tags.tag_id WHERE tags.updated_at >= ?)",
+		since, since, since,
+	)
+	reindexed, err := bulkIndexPins(ctx, db, es, index, changed, 0)
+	if err != nil {
+		return since, err
+	}
+
+	if err := es.RefreshIndex(ctx, index); err != nil {
+		return since, err
+	}
+	removed, err := removeDeletedPins(ctx, db, es, index)
+	if err != nil {
+		return since, err
+	}
+	if err := es.RefreshIndex(ctx, index); err != nil {
+		return since, err
+	}
+
+	if reindexed > 0 || removed > 0 {
+		log.Printf("Caught up %s: reindexed %d changed pins, removed %d deleted pins", index, reindexed, removed)
+	}
+	return next, nil
+}
+
+// removeDeletedPins удаляет из индекса документы пинов, которых нет в базе, и возвращает их количество
+func removeDeletedPins(ctx context.Context, db *gorm.DB, es *elasticsearch.ESClient, index string) (int, error) {
+	removed := 0
+	lastID := 0
+	for {
+		ids, err := es.PinDocumentIDs(ctx, index, lastID, reindexBatchSize)
+		if err != nil {
+			return removed, err
+		}
+		if len(ids) == 0 {
+			return removed, nil
+		}
+		lastID = ids[len(ids)-1]
+
+		var existing []int
+		if err := db.Model(&models.Pin{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+			return removed, fmt.Errorf("failed to check pins: %v", err)
+		}
+		exists := make(map[int]bool, len(existing))
+		for _, id := range existing {
+			exists[id] = true
+		}
+		var missing []int
+		for _, id := range ids {
+			if !exists[id] {
+				missing = append(missing, id)
+			}
+		}
+		if err := es.BulkDeletePins(ctx, index, missing); err != nil {
+			return removed, err
+		}
+		removed += len(missing)
+	}
+}
+
+// bulkIndexPins индексирует выбранные запросом пины пачками по reindexBatchSize, двигаясь по id.
+// total нужен только для вывода прогресса
+func bulkIndexPins(ctx context.Context, db *gorm.DB, es *elasticsearch.ESClient, index string, query *gorm.DB, total int) (int, error) {
+	indexed := 0
+	lastID := 0
+	for {
+		var pins []models.Pin
+		if err := query.Session(&gorm.Session{}).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(reindexBatchSize).
+			Find(&pins).Error; err != nil {
+			return indexed, fmt.Errorf("failed to fetch pins: %v", err)
+		}
+		if len(pins) == 0 {
+			return indexed, nil
+		}
+
+		ids := make([]int, len(pins))
+		for i, pin := range pins {
+			ids[i] = pin.ID
+		}
+		tags, err := fetchTagsByPin(db, ids)
+		if err != nil {
+			return indexed, err
+		}
+		stats, err := engagement.LoadStats(db, ids)
+		if err != nil {
+			return indexed, err
+		}
+
+		docs := make([]elasticsearch.PinDocument, len(pins))
+		for i := range pins {
+			docs[i] = elasticsearch.NewPinDocument(&pins[i], tags[pins[i].ID], stats[pins[i].ID])
+		}
+		if err := es.BulkIndexPins(ctx, index, docs); err != nil {
+			return indexed, err
+		}
+
+		indexed += len(pins)
+		lastID = pins[len(pins)-1].ID
+		if total > 0 {
+			log.Printf("[%d/%d] pins indexed", indexed, total)
+		}
+	}
+}
+
+// fetchTagsByPin загружает теги сразу для нескольких пинов
+func fetchTagsByPin(db *gorm.DB, pinIDs []int) (map[int][]models.Tag, error) {
+	var rows []struct {
+		PinID int
+		models.Tag
+	}
+	if err := db.Table("tags").
+		Select("pin_tags.pin_id, tags.*").
+		Joins("JOIN pin_tags ON pin_tags.tag_id = tags.id").
+		Where("pin_tags.pin_id IN ?", pinIDs).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pin tags: %v", err)
+	}
+
+	tags := make(map[int][]models.Tag, len(pinIDs))
+	for _, row := range rows {
+		tags[row.PinID] = append(tags[row.PinID], row.Tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"pornterest/internal/elasticsearch"
+	"pornterest/internal/models"
+	"pornterest/internal/tagsuggest"
+
+	"gorm.io/gorm"
+)
+
+// RebuildTagIndex пересоздает индекс подсказок тегов с текущим TagMapping и заполняет его всеми тегами.
+// Пока индекс заполняется, подсказки неполные — индекс маленький, это секунды.
+// В режиме dryRun только сообщает, сколько тегов будет проиндексировано
+func RebuildTagIndex(db *gorm.DB, es *elasticsearch.ESClient, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if es == nil {
+		return fmt.Errorf("elasticsearch client is nil")
+	}
+
+	ctx := context.Background()
+
+	var total int64
+	if err := db.Model(&models.Tag{}).Count(&total).Error; err != nil {
+		return fmt.Errorf("failed to count tags: %v", err)
+	}
+
+	log.Printf("Rebuilding index %s with %d tags", elasticsearch.TagsIndex, total)
+	if dryRun {
+		return nil
+	}
+
+	if err := es.DeleteIndices(ctx, []string{elasticsearch.TagsIndex}); err != nil {
+		return fmt.Errorf("failed to delete %s: %v", elasticsearch.TagsIndex, err)
+	}
+	if err := es.EnsureTagIndex(ctx); err != nil {
+		return fmt.Errorf("failed to create %s: %v", elasticsearch.TagsIndex, err)
+	}
+
+	indexed := 0
+	lastID := 0
+	for {
+		var tags []models.Tag
+		if err := db.Where("id > ?", lastID).Order("id ASC").Limit(reindexBatchSize).Find(&tags).Error; err != nil {
+			return fmt.Errorf("failed to fetch tags: %v", err)
+		}
+		if len(tags) == 0 {
+			break
+		}
+
+		if err := tagsuggest.IndexTags(ctx, db, es, tags); err != nil {
+			return err
+		}
+
+		indexed += len(tags)
+		lastID = tags[len(tags)-1].ID
+		log.Printf("[%d/%d] tags indexed", indexed, total)
+	}
+
+	log.Printf("Tag index rebuilt: %d tags", indexed)
+	return nil
+}
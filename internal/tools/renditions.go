@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"pornterest/internal/media"
+	"pornterest/internal/models"
+	"pornterest/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// renditionsBatchSize — сколько пинов без копий выбирается из базы за один запрос
+const renditionsBatchSize = 100
+
+// BackfillRenditions генерирует уменьшенные копии для изображений, у которых их еще нет.
+// В режиме dryRun только выводит список пинов
+func BackfillRenditions(db *gorm.DB, store storage.Storage, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if store == nil {
+		return fmt.Errorf("media storage is nil")
+	}
+
+	// Изображения не шире самой маленькой копии остаются без копий навсегда — их не выбираем,
+	// иначе каждый запуск заново скачивал бы их оригиналы
+	minWidth := media.RenditionSpecs[0].Width
+	for _, spec := range media.RenditionSpecs {
+		minWidth = min(minWidth, spec.Width)
+	}
+
+	found, generated, lastID := 0, 0, 0
+	for {
+		var pins []models.Pin
+		if err := db.
+			Where("type = ? AND id > ?", media.TypeImage, lastID).
+			Where("width IS NULL OR width > ?", minWidth).
+			Where("NOT EXISTS (SELECT 1 FROM pin_renditions WHERE pin_renditions.pin_id = pins.id)").
+			Order("id ASC").
+			Limit(renditionsBatchSize).
+			Find(&pins).Error; err != nil {
+			return fmt.Errorf("failed to fetch pins: %v", err)
+		}
+		if len(pins) == 0 {
+			break
+		}
+		lastID = pins[len(pins)-1].ID
+
+		for _, pin := range pins {
+			found++
+			key := storage.KeyFromPath(pin.Path)
+			log.Printf("[%d] Pin %d (%s)", found, pin.ID, key)
+			if dryRun || key == "" {
+				continue
+			}
+
+			if err := backfillPinRenditions(context.Background(), db, store, pin.ID, key); err != nil {
+				log.Printf("Failed to generate renditions for pin %d: %v", pin.ID, err)
+				continue
+			}
+			generated++
+		}
+	}
+
+	log.Printf("Renditions backfill completed: %d of %d pins without renditions processed", generated, found)
+	return nil
+}
+
+func backfillPinRenditions(ctx context.Context, db *gorm.DB, store storage.Storage, pinID int, key string) error {
+	original, _, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer original.Close()
+
+	renditions, err := media.StoreRenditions(ctx, store, pinID, key, original)
+	if err != nil {
+		return err
+	}
+	if len(renditions) == 0 {
+		// Изображение меньше самой маленькой копии — отдаем только оригинал
+		return nil
+	}
+	return db.Create(&renditions).Error
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"pornterest/internal/models"
+	"pornterest/internal/outbox"
+	"pornterest/internal/tasks"
+
+	"gorm.io/gorm"
+)
+
+// TranslateTags переводит на русский теги без title_ru и ставит их пины в outbox на переиндексацию.
+// limit ограничивает количество тегов за запуск (0 — без ограничения). В режиме dryRun только выводит список
+func TranslateTags(db *gorm.DB, limit int, dryRun bool) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	query := db.Where("(title_ru = '' OR title_ru IS NULL) AND title_en <> ''").Order("count DESC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var tags []models.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		return fmt.Errorf("failed to fetch tags: %v", err)
+	}
+
+	log.Printf("Found %d tags without Russian title", len(tags))
+
+	translated := 0
+	for i, tag := range tags {
+		log.Printf("[%d/%d] Tag %d: %s", i+1, len(tags), tag.ID, tag.TitleEN)
+		if dryRun {
+			continue
+		}
+
+		title, err := tasks.TranslateText(tag.TitleEN)
+		if err != nil {
+			log.Printf("Failed to translate tag %d: %v", tag.ID, err)
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Tag{}).Where("id = ?", tag.ID).Updates(map[string]interface{}{
+				"title_ru":   title,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			return outbox.EnqueueTagPins(tx, tag.ID)
+		})
+		if err != nil {
+			log.Printf("Failed to save translation of tag %d: %v", tag.ID, err)
+			continue
+		}
+
+		log.Printf("Tag %d: %s -> %s", tag.ID, tag.TitleEN, title)
+		translated++
+
+		// Не упираемся в ограничения API переводчика, как и очередь переводов в API
+		time.Sleep(time.Second)
+	}
+
+	log.Printf("Tag translation completed: %d of %d tags translated", translated, len(tags))
+	return nil
+}
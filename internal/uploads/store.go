@@ -0,0 +1,248 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pornterest/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxSize — максимальный размер файла, принимаемого возобновляемой загрузкой
+const MaxSize int64 = 2 << 30
+
+// Expiration — сколько живет загрузка с момента последнего полученного фрагмента
+const Expiration = 24 * time.Hour
+
+// lockClass — первый ключ advisory-блокировок загрузок, второй — хэш ID загрузки
+const lockClass = 7_402_116
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+)
+
+// Store хранит состояние возобновляемых загрузок: строки uploads в базе и файлы с данными в dir.
+// Состояние переживает перезапуск сервера. Если API запущен в нескольких репликах,
+// dir должен быть общим для них
+type Store struct {
+	db  *gorm.DB
+	dir string
+}
+
+// NewStore создает хранилище загрузок, каталог dir создается при необходимости
+func NewStore(db *gorm.DB, dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &Store{db: db, dir: dir}, nil
+}
+
+// Create регистрирует новую загрузку длиной length байт и создает пустой файл для ее данных
+func (s *Store) Create(userID int, length int64, metadata map[string]string) (*models.Upload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	upload := &models.Upload{
+		ID:        id,
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(Expiration),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := s.db.Create(upload).Error; err != nil {
+		os.Remove(s.dataPath(id))
+		return nil, fmt.Errorf("failed to save upload: %w", err)
+	}
+	return upload, nil
+}
+
+// Get возвращает загрузку по ID
+func (s *Store) Get(id string) (*models.Upload, error) {
+	var upload models.Upload
+	if err := s.db.Where("id = ?", id).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// Lock блокирует загрузку, чтобы фрагменты и ее завершение не обрабатывались одновременно,
+// в том числе на разных репликах. Это advisory-блокировка Postgres: пока она держится, занято
+// одно соединение пула, а если процесс упадет, база снимет ее сама. Возвращает функцию снятия блокировки
+func (s *Store) Lock(ctx context.Context, id string) (func(), error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// Блокировка сессионная, поэтому берется и снимается на одном и том же соединении
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, hashtext($2))", lockClass, id); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock upload %s: %w", id, err)
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1, hashtext($2))", lockClass, id); err != nil {
+			// Соединение с неснятой блокировкой нельзя возвращать в пул: закрываем его, и база снимет блокировку
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
+
+// Append дописывает данные из r начиная с offset, который должен совпадать с уже принятым объемом.
+// Принятые байты сохраняются, даже если чтение r оборвалось на середине: клиент продолжит с нового смещения.
+// Вызывающий должен держать Lock загрузки
+func (s *Store) Append(upload *models.Upload, offset int64, r io.Reader) error {
+	if offset != upload.Offset {
+		return ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.dataPath(upload.ID), os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	// После аварийной остановки в файле могут остаться байты, не учтенные в базе
+	if err := file.Truncate(upload.Offset); err != nil {
+		return fmt.Errorf("failed to truncate upload file: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(r, upload.Length-upload.Offset))
+	if written > 0 {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync upload file: %w", err)
+		}
+
+		upload.Offset += written
+		upload.ExpiresAt = time.Now().Add(Expiration)
+		if err := s.db.Model(upload).Updates(map[string]interface{}{
+			"upload_offset": upload.Offset,
+			"expires_at":    upload.ExpiresAt,
+			"updated_at":    time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to save upload offset: %w", err)
+		}
+	}
+
+	if copyErr != nil {
+		return fmt.Errorf("failed to receive upload data: %w", copyErr)
+	}
+	return nil
+}
+
+// Open открывает файл с данными загрузки для чтения
+func (s *Store) Open(upload *models.Upload) (*os.File, error) {
+	return os.Open(s.dataPath(upload.ID))
+}
+
+// Complete отмечает, что из загрузки создан пин, и удаляет ее временный файл.
+// Строка остается до истечения срока, чтобы клиент мог узнать ID пина
+func (s *Store) Complete(upload *models.Upload, pinID int) error {
+	upload.PinID = &pinID
+	if err := s.db.Model(upload).Updates(map[string]interface{}{
+		"pin_id":     pinID,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	if err := os.Remove(s.dataPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+	return nil
+}
+
+// Delete удаляет загрузку вместе с ее данными
+func (s *Store) Delete(upload *models.Upload) error {
+	if err := s.db.Delete(&models.Upload{}, "id = ?", upload.ID).Error; err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if err := os.Remove(s.dataPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+	return nil
+}
+
+// Cleanup удаляет загрузки с истекшим сроком и возвращает их количество
+func (s *Store) Cleanup() (int, error) {
+	var expired []models.Upload
+	if err := s.db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch expired uploads: %w", err)
+	}
+
+	removed := 0
+	for i := range expired {
+		unlock, err := s.Lock(context.Background(), expired[i].ID)
+		if err != nil {
+			return removed, err
+		}
+		err = s.Delete(&expired[i])
+		unlock()
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// StartCleanup периодически удаляет брошенные загрузки
+func (s *Store) StartCleanup(interval time.Duration, logger *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			removed, err := s.Cleanup()
+			if err != nil {
+				logger.Error("failed to clean up expired uploads", "error", err)
+				continue
+			}
+			if removed > 0 {
+				logger.Info("removed expired uploads", "count", removed)
+			}
+		}
+	}()
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}